@@ -59,19 +59,29 @@ fi
 echo "Starting container..."
 docker start "$CONTAINER_NAME"
 
-# Wait for service to be ready
-echo "Waiting for service to start..."
-sleep 5
+# Wait for the application to report it is ready, which
+# also runs its readiness checks like the database ping
+echo "Waiting for service to be ready..."
+READY=""
+for attempt in $(seq 1 30); do
+    if curl -fsk -L --max-time 5 http://localhost:80/_ready >/dev/null 2>&1; then
+        READY="yes"
+        break
+    fi
+    sleep 2
+done
+
+if [ -n "$READY" ]; then
+    echo "✅ Deployment successful! Container '$CONTAINER_NAME' is ready"
 
-# Check if service is running
-if docker ps | grep -q "$CONTAINER_NAME"; then
-    echo "✅ Deployment successful! Container '$CONTAINER_NAME' is running"
-    
     # Show container logs
     echo "Recent logs:"
     docker logs "$CONTAINER_NAME" --tail 10
 else
-    echo "❌ Deployment failed! Container is not running"
+    echo "❌ Deployment failed! Service did not become ready"
+    echo "Readiness checks:"
+    curl -sk -L --max-time 5 http://localhost:80/_ready || true
+    echo ""
     echo "Container logs:"
     docker logs "$CONTAINER_NAME" --tail 20
     exit 1
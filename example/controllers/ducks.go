@@ -21,8 +21,9 @@ type DucksController struct {
 func (c *DucksController) Setup(app *application.App) {
 	c.BaseController.Setup(app)
 
-	http.Handle("GET /", app.Serve("dashboard.html", nil))
-	http.Handle("POST /", app.ProtectFunc(c.spawnDuck, nil))
+	app.Handle("GET /", app.Serve("dashboard.html", nil))
+	app.Handle("POST /", app.ProtectFunc(c.spawnDuck, nil))
+	app.HandleFunc("GET /events", c.events)
 }
 
 // Handle is called when each request is handled
@@ -33,7 +34,7 @@ func (c DucksController) Handle(req *http.Request) application.Controller {
 
 // AllDucks is a function that can be called in views
 func (c *DucksController) AllDucks() ([]*models.Duck, error) {
-	return models.Ducks.Search("")
+	return models.Ducks.SearchContext(c.Context(), "")
 }
 
 // spawnDuck is a HandlerFunc that is called when the user submits a duck
@@ -45,11 +46,17 @@ func (c *DucksController) spawnDuck(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Saving ducks to the ducks collection
-	if _, err := models.Ducks.Insert(duck); err != nil {
+	if _, err := models.Ducks.InsertContext(r.Context(), duck); err != nil {
 		c.Render(w, r, "error-message", err)
 		return
 	}
 
-	// Refreshing the page via HTMX integration
-	c.Refresh(w, r)
+	// Pushing the new list to every open dashboard
+	c.Hub().Publish("ducks", "duck-list", nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// events streams the duck list to the dashboard as it changes
+func (c *DucksController) events(w http.ResponseWriter, r *http.Request) {
+	c.Hub().Subscribe(w, r, "ducks")
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"cmp"
+	"context"
 	"embed"
 	"os"
 
@@ -25,7 +26,13 @@ func main() {
 	application.Serve(views,
 		application.WithHostPrefix(os.Getenv("PREFIX")),
 		application.WithDaisyTheme(os.Getenv("THEME")),
+		application.WithRecovery(),
+		application.WithMiddleware(application.RequestID, application.Logger, application.SecureHeaders, application.Gzip),
 		application.WithController("auth", auth),
 		application.WithController(controllers.Ducks()),
+		application.WithCheck("database", models.DB.Ping),
+		application.WithShutdownHook(func(context.Context) error {
+			return models.DB.Close()
+		}),
 	)
 }
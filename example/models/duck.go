@@ -1,6 +1,10 @@
 package models
 
-import "github.com/The-Skyscape/devtools/pkg/application"
+import (
+	"context"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
 
 // Table is the name of the table where ducks are stored
 func (*Duck) Table() string { return "ducks" }
@@ -13,18 +17,18 @@ type Duck struct {
 }
 
 // GetDuckByID returns a duck by its ID
-func GetDuckByID(id string) (*Duck, error) {
-	return Ducks.Get(id)
+func GetDuckByID(ctx context.Context, id string) (*Duck, error) {
+	return Ducks.GetContext(ctx, id)
 }
 
 // GetDuckByBreed returns a list of ducks
-func DucksByBreed(breed string) ([]*Duck, error) {
-	return Ducks.Search("breed = ?", breed)
+func DucksByBreed(ctx context.Context, breed string) ([]*Duck, error) {
+	return Ducks.Where("Breed", breed).AllContext(ctx)
 }
 
 // GetDuckByName returns a single named duck
-func DucksByName(name string) (*Duck, error) {
-	return Ducks.Find("name = ?", name)
+func DucksByName(ctx context.Context, name string) (*Duck, error) {
+	return Ducks.Where("Name", name).FirstContext(ctx)
 }
 
 // Quack is a public method that can be called in views
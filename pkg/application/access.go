@@ -4,22 +4,29 @@ import "net/http"
 
 type AccessCheck func(*App, *http.Request) string
 
-func (app *App) Protect(h http.Handler, accessCheck AccessCheck) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// Access returns middleware that renders the page returned
+// by the access check instead of calling the next handler
+func (app *App) Access(accessCheck AccessCheck) Middleware {
+	return func(h http.Handler) http.Handler {
 		if accessCheck == nil {
-			h.ServeHTTP(w, r)
-			return
+			return h
 		}
 
-		if page := accessCheck(app, r); page != "" {
-			app.Render(w, r, page, nil)
-			return
-		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if page := accessCheck(app, r); page != "" {
+				app.Deny(w, r, page)
+				return
+			}
 
-		h.ServeHTTP(w, r)
+			h.ServeHTTP(w, r)
+		})
 	}
 }
 
+func (app *App) Protect(h http.Handler, accessCheck AccessCheck) http.HandlerFunc {
+	return app.Access(accessCheck)(h).ServeHTTP
+}
+
 func (app *App) ProtectFunc(fn http.HandlerFunc, accessLevel AccessCheck) http.HandlerFunc {
 	return app.Protect(fn, accessLevel)
 }
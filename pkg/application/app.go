@@ -2,6 +2,8 @@ package application
 
 import (
 	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -9,32 +11,92 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 func Serve(views fs.FS, opts ...Option) {
 	log.Printf("🚀 Starting Skyscape Application...")
 	log.Printf("📱 Visit: http://localhost:%s", cmp.Or(os.Getenv("PORT"), "8080"))
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	app := New(views, opts...)
-	if err := app.Start(); err != nil {
+	if err := app.StartContext(ctx); err != nil {
 		log.Fatal(err)
 	}
 }
 
 type App struct {
-	controllers map[string]Controller
-	viewEngine  *template.Template
-	hostPrefix  string
-	views       []fs.FS
-	theme       string
+	mux          *http.ServeMux
+	middleware   []Middleware
+	handler      http.Handler
+	chainOnce    sync.Once
+	controllers  map[string]Controller
+	routes       map[string]string
+	viewEngine   *viewSet
+	viewErr      error
+	viewsMu      sync.RWMutex
+	funcs        template.FuncMap
+	hostPrefix   string
+	views        []fs.FS
+	theme        string
+	devMode      bool
+	devViews     fs.FS
+	watchOnce    sync.Once
+	csrfSecret   []byte
+	cdn          bool
+	locale       string
+	localeFuncs  []LocaleFunc
+	assets       *assetSet
+	csrfExempt   []string
+	csrfDisabled bool
+
+	// Flash messages
+	flashStore FlashStore
+
+	// Rate limits
+	rateStore RateStore
+
+	// Health checks and metrics
+	checks  []namedCheck
+	metrics *metrics
+
+	// Server sent events
+	hub     *Hub
+	hubOnce sync.Once
+
+	// Server lifecycle
+	certManager *autocert.Manager
+	acmeClient  *acme.Client
+	servers     []*http.Server
+	cancel      context.CancelFunc
+	hooks       []func(context.Context) error
+	stopped     chan struct{}
+	stopOnce    sync.Once
+	stopErr     error
 }
 
 func New(views fs.FS, opts ...Option) *App {
 	app := App{
+		mux:         http.NewServeMux(),
 		controllers: map[string]Controller{},
+		routes:      map[string]string{},
+		funcs:       template.FuncMap{},
 		views:       []fs.FS{appViews},
 		theme:       "retro",
+		locale:      "en",
+		flashStore:  cookieFlashes(),
+		rateStore:   NewMemoryRates(),
+		metrics:     newMetrics(),
+		stopped:     make(chan struct{}),
 	}
 
 	if views != nil {
@@ -42,92 +104,151 @@ func New(views fs.FS, opts ...Option) *App {
 
 		if _, err := fs.Sub(views, "views/public"); err == nil {
 			public, _ := fs.Sub(views, "views")
-			http.Handle("GET /public/", http.FileServerFS(public))
+			app.Handle("GET /public/", app.servePublic(public))
 		}
 	}
 
+	if os.Getenv("CONGO_DEV") != "" {
+		opts = append([]Option{WithDevMode()}, opts...)
+	}
+
 	for _, opt := range opts {
 		if err := opt(&app); err != nil {
 			log.Fatal("Failed to setup Congo server:", err)
 		}
 	}
 
+	if !app.csrfDisabled {
+		if err := app.setupCSRF(); err != nil {
+			log.Fatal("Failed to setup Congo server:", err)
+		}
+	}
+
+	// In dev mode the application's views are read from disk
+	// rather than the embedded copy, so edits show immediately
+	if app.devMode && views != nil {
+		app.views[1] = app.devViews
+	}
+
+	app.assets = app.loadAssets()
+	app.HandleFunc("GET /_assets/{file...}", app.serveAsset)
+	app.HandleFunc("GET /_health", app.health)
+	app.HandleFunc("GET /_ready", app.ready)
+	app.HandleFunc("GET /_metrics", app.serveMetrics)
+
 	return &app
 }
 
 // Use returns the controller with the given name
-func (app App) Use(name string) Controller {
+func (app *App) Use(name string) Controller {
 	return app.controllers[name]
 }
 
-// Start runs the application HTTP server and SSL server
-func (app *App) Start() error {
-	log.Println("Starting Application...")
-
-	app.prepareViews()
+// Handle registers the handler for the given pattern on the app's router,
+// wrapped in the given middleware with the first being the outermost.
+// The returned route can be named to build links to it.
+func (app *App) Handle(pattern string, handler http.Handler, mw ...Middleware) *Route {
+	app.mux.Handle(pattern, routed(pattern, Chain(handler, mw...)))
+	return &Route{app: app, pattern: pattern}
+}
 
-	go func() {
-		cert := cmp.Or(os.Getenv("CONGO_SSL_FULLCHAIN"), "/root/fullchain.pem")
-		if _, err := os.Stat(cert); err != nil {
-			log.Println("No SSL Certificate found at:", cert)
-			return
-		}
+// HandleFunc registers the handler func for the given pattern on the app's router
+func (app *App) HandleFunc(pattern string, fn http.HandlerFunc, mw ...Middleware) *Route {
+	return app.Handle(pattern, fn, mw...)
+}
 
-		key := cmp.Or(os.Getenv("CONGO_SSL_PRIVKEY"), "/root/privkey.pem")
-		if _, err := os.Stat(key); err != nil {
-			log.Println("No SSL Key found at:", key)
-			return
-		}
+// UseMiddleware adds middleware that wraps every route of the application.
+// It must be called before the application starts serving requests.
+func (app *App) UseMiddleware(mw ...Middleware) {
+	app.middleware = append(app.middleware, mw...)
+}
 
-		if cert != "" && key != "" {
-			log.Print("Serving Secure Congo @ https://localhost:443")
-			log.Fatal(http.ListenAndServeTLS("0.0.0.0:443", cert, key, nil))
-		}
+// ServeHTTP dispatches the request through the global middleware
+// to the handler registered on the app's router, measuring it by route
+func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.chainOnce.Do(func() {
+		app.handler = Chain(app.mux, app.middleware...)
+	})
+
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	r, route := trackRoute(r)
+	defer func() {
+		app.metrics.observeRequest(route.pattern, r.Method, sw.status, time.Since(start))
 	}()
 
-	addr := "0.0.0.0:" + cmp.Or(os.Getenv("PORT"), "5000")
-	log.Print("Serving Unsecure Congo @ http://" + addr)
-	return http.ListenAndServe(addr, nil)
+	app.handler.ServeHTTP(sw, app.withFlashes(sw, withLocaleState(withBindState(r))))
 }
 
-func (app *App) Server() (string, http.Handler) {
-	addr := "0.0.0.0:" + cmp.Or(os.Getenv("PORT"), "5000")
-	log.Print("Serving Unsecure Congo @ http://" + addr)
-	return addr, nil
+// ErrViewNotFound is returned when rendering a view that does not exist
+var ErrViewNotFound = errors.New("view not found")
+
+// Render renders a view with given data to the writer. It returns an
+// error when the view cannot be parsed or found, while errors executing
+// the view are rendered with the error-message template.
+func (app *App) Render(w io.Writer, r *http.Request, page string, data any) error {
+	return app.render(w, r, page, "", data)
 }
 
-// Render renders a view with given data to the http writer
-func (app *App) Render(w io.Writer, r *http.Request, page string, data any) {
-	funcs := template.FuncMap{
-		// {{req.URL.Query.Get "search"}}
-		"req": func() *http.Request { return r },
-		// {{host}}
-		"host": func() string { return app.hostPrefix },
-		// {{if path_eq "project" .ID "settings"}} ... {{end}}
-		"path_eq": func(parts ...string) bool {
-			path := fmt.Sprintf("/%s", strings.Join(parts, "/"))
-			return r.URL.Path == path
-		},
+// render executes a page, or one of its blocks when named. Pages with a
+// layout are rendered without it for HTMX requests that swap part of the
+// page, while boosted requests and history restores get the full page.
+// Clients that prefer JSON receive the data as JSON instead.
+func (app *App) render(w io.Writer, r *http.Request, page, block string, data any) error {
+	if rw, ok := w.(http.ResponseWriter); ok && block == "" && WantsJSON(r) {
+		app.renderJSON(rw, data)
+		return nil
+	}
+
+	views, err := app.templates()
+	if err != nil {
+		if rw, ok := w.(http.ResponseWriter); ok {
+			rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprintf(w, "<h1>Failed to parse views</h1><pre>%s</pre>", template.HTMLEscapeString(err.Error()))
+		return err
 	}
 
-	for name, ctrl := range app.controllers {
-		funcs[name] = func() Controller { return ctrl.Handle(r) }
+	// Each render borrows its own copy of the views with
+	// funcs bound to this request, so concurrent renders
+	// never see each other's request or controllers.
+	rr, set := views.get(app, page, r)
+	defer set.put(rr)
+
+	// Flashes are taken before any page is written,
+	// while the store can still clear them
+	if _, ok := w.(http.ResponseWriter); ok && block == "" {
+		Flashes(r)
 	}
 
-	view := app.viewEngine.Lookup(page)
+	if p, ok := views.pages[page]; ok && block == "" {
+		if rw, ok := w.(http.ResponseWriter); ok {
+			rw.Header().Add("Vary", "HX-Request")
+		}
+		if IsPartial(r) {
+			block = p.name
+		}
+	}
+
+	view := rr.lookup(page, block, data)
 	if view == nil {
-		log.Println("view not found", page)
+		name := strings.TrimSpace(page + " " + block)
+		log.Println("view not found", name)
 		if rw, ok := w.(http.ResponseWriter); ok {
-			http.Error(rw, "view not found 1", http.StatusNotFound)
-			return
-		} else {
-			fmt.Fprintf(w, "view not found 2")
-			os.Exit(1)
+			http.Error(rw, "view not found", http.StatusNotFound)
 		}
+		return fmt.Errorf("%w: %s", ErrViewNotFound, name)
 	}
 
-	if err := view.Funcs(funcs).Execute(w, data); err != nil {
+	start := time.Now()
+	defer func() {
+		app.metrics.observeRender(strings.TrimSpace(page+" "+block), time.Since(start))
+	}()
+
+	if err := view.Execute(w, data); err != nil {
 		log.Print("Error rendering: ", err)
-		app.viewEngine.ExecuteTemplate(w, "error-message", err)
+		rr.ExecuteTemplate(w, "error-message", err)
 	}
+	return nil
 }
@@ -0,0 +1,63 @@
+package application
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// serve starts an app with a page of its own, rendered by its only route
+func serve(t *testing.T, route, body string) *httptest.Server {
+	t.Helper()
+
+	app := New(fstest.MapFS{
+		"views/page.html": {Data: []byte(body + ` {{greeting}}`)},
+	}, WithFunc("greeting", func() string { return "from " + route }))
+
+	app.HandleFunc("GET "+route, func(w http.ResponseWriter, r *http.Request) {
+		app.Render(w, r, "page", nil)
+	})
+
+	_, handler := app.Server()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, strings.TrimSpace(string(body))
+}
+
+func TestAppsInOneProcess(t *testing.T) {
+	one := serve(t, "/one", "first")
+	two := serve(t, "/two", "second")
+
+	if status, body := get(t, one.URL+"/one"); status != http.StatusOK || body != "first from /one" {
+		t.Errorf("first app served %d %q, want its own page", status, body)
+	}
+	if status, body := get(t, two.URL+"/two"); status != http.StatusOK || body != "second from /two" {
+		t.Errorf("second app served %d %q, want its own page", status, body)
+	}
+
+	if status, _ := get(t, one.URL+"/two"); status != http.StatusNotFound {
+		t.Errorf("first app served the second app's route with %d", status)
+	}
+	if status, _ := get(t, two.URL+"/one"); status != http.StatusNotFound {
+		t.Errorf("second app served the first app's route with %d", status)
+	}
+}
@@ -0,0 +1,203 @@
+package application
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:generate go run assets_generate.go
+
+//go:embed all:assets
+var vendorFS embed.FS
+
+// assetCache is how long browsers keep fingerprinted assets,
+// which never change as their URL changes with their content
+const assetCache = "public, max-age=31536000, immutable"
+
+// assetFile is a file served under its fingerprinted name
+type assetFile struct {
+	fsys fs.FS
+	path string
+	etag string
+}
+
+// assetSet maps asset names to their URLs, fingerprinted names
+// to the files they serve and public files to their ETags
+type assetSet struct {
+	urls  map[string]string
+	files map[string]assetFile
+	etags map[string]string
+}
+
+// WithCDN loads the framework's libraries, like HTMX and DaisyUI, from
+// their CDNs at the pinned versions instead of serving the embedded copies
+func WithCDN() Option {
+	return func(app *App) error {
+		app.cdn = true
+		return nil
+	}
+}
+
+// loadAssets fingerprints the framework's libraries and the files
+// in views/public, hashing their contents once at startup
+func (app *App) loadAssets() *assetSet {
+	set := &assetSet{
+		urls:  map[string]string{},
+		files: map[string]assetFile{},
+		etags: map[string]string{},
+	}
+
+	vendor, err := vendorAssets()
+	if err != nil {
+		log.Fatal("Failed to read vendor assets: ", err)
+	}
+
+	var missing []string
+	for _, lib := range vendor {
+		if app.cdn {
+			set.urls[lib.name] = lib.url
+			continue
+		}
+
+		sub, _ := fs.Sub(vendorFS, "assets")
+		if _, err := set.add(sub, lib.name); err != nil {
+			missing = append(missing, lib.name)
+			set.urls[lib.name] = lib.url
+		}
+	}
+
+	if len(missing) > 0 {
+		log.Printf("Vendor assets %s are not embedded, run go generate in pkg/application to embed them. "+
+			"Loading them from the CDN until then, which fails without network access.", strings.Join(missing, ", "))
+	}
+
+	// Application files override the framework's of the same name
+	for _, source := range app.views[1:] {
+		public, err := fs.Sub(source, "views/public")
+		if err != nil {
+			continue
+		}
+
+		fs.WalkDir(public, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			etag, err := set.add(public, name)
+			if err != nil {
+				log.Printf("Failed to fingerprint %s: %v", name, err)
+				return nil
+			}
+			set.etags[name] = etag
+			return nil
+		})
+	}
+
+	return set
+}
+
+// add hashes the file and maps its name to its fingerprinted URL,
+// returning the hash as an ETag
+func (set *assetSet) add(fsys fs.FS, name string) (string, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:4])
+	ext := path.Ext(name)
+	fingerprinted := strings.TrimSuffix(name, ext) + "." + hash + ext
+
+	etag := `"` + hash + `"`
+	set.urls[name] = "/_assets/" + fingerprinted
+	set.files[fingerprinted] = assetFile{fsys: fsys, path: name, etag: etag}
+	return etag, nil
+}
+
+// asset returns the URL of a library or a file in views/public, like
+// {{asset "htmx.js"}}, with a fingerprint so it can be cached forever
+func (app *App) asset(name string) (string, error) {
+	name = strings.TrimPrefix(name, "/")
+
+	// In dev mode public files are edited on disk, so they are not fingerprinted
+	if app.devMode {
+		if _, err := fs.Stat(app.devViews, path.Join("views/public", name)); err == nil {
+			return app.hostPrefix + "/public/" + name, nil
+		}
+	}
+
+	url, ok := app.assets.urls[name]
+	if !ok {
+		return "", fmt.Errorf("unknown asset %q", name)
+	}
+
+	if strings.HasPrefix(url, "/") {
+		url = app.hostPrefix + url
+	}
+	return url, nil
+}
+
+// serveAsset serves a fingerprinted asset with long cache headers
+func (app *App) serveAsset(w http.ResponseWriter, r *http.Request) {
+	file, ok := app.assets.files[r.PathValue("file")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", assetCache)
+	w.Header().Set("ETag", file.etag)
+	http.ServeFileFS(w, r, file.fsys, file.path)
+}
+
+// servePublic serves views/public at its plain URLs, which browsers
+// revalidate with the file's hash before using their cached copy
+func (app *App) servePublic(public fs.FS) http.Handler {
+	files := http.FileServerFS(public)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		if etag, ok := app.assets.etags[strings.TrimPrefix(r.URL.Path, "/public/")]; ok && !app.devMode {
+			w.Header().Set("ETag", etag)
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// vendorLib is a pinned library listed in assets/vendor.txt
+type vendorLib struct {
+	name, url string
+}
+
+// vendorAssets reads the pinned libraries from assets/vendor.txt
+func vendorAssets() ([]vendorLib, error) {
+	data, err := vendorFS.ReadFile("assets/vendor.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	var libs []vendorLib
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid vendor asset %q", line)
+		}
+		libs = append(libs, vendorLib{name: fields[0], url: fields[1]})
+	}
+
+	return libs, scanner.Err()
+}
@@ -0,0 +1,65 @@
+//go:build ignore
+
+// Fetches the pinned libraries listed in assets/vendor.txt into assets/,
+// run with go generate after changing a version
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	manifest, err := os.Open("assets/vendor.txt")
+	if err != nil {
+		log.Fatal("Failed to open vendor manifest: ", err)
+	}
+	defer manifest.Close()
+
+	scanner := bufio.NewScanner(manifest)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			log.Fatalf("Invalid vendor asset %q", line)
+		}
+
+		if err := fetch(fields[1], filepath.Join("assets", fields[0])); err != nil {
+			log.Fatalf("Failed to fetch %s: %v", fields[0], err)
+		}
+		log.Println("Fetched", fields[0], "from", fields[1])
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatal("Failed to read vendor manifest: ", err)
+	}
+}
+
+func fetch(url, dest string) error {
+	res, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dest, data, 0644)
+}
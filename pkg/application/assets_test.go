@@ -0,0 +1,44 @@
+package application
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssetsAreFingerprinted(t *testing.T) {
+	app := New(fstest.MapFS{
+		"views/public/htmx.js": {Data: []byte(`console.log("htmx")`)},
+	})
+
+	url, err := app.asset("htmx.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "/_assets/htmx.") {
+		t.Fatalf("htmx.js is linked at %q, want a fingerprinted URL", url)
+	}
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != `console.log("htmx")` {
+		t.Fatalf("%s served %d %q", url, rec.Code, rec.Body.String())
+	}
+	if cache := rec.Header().Get("Cache-Control"); cache != assetCache {
+		t.Errorf("%s is cached with %q, want %q", url, cache, assetCache)
+	}
+}
+
+func TestWithCDN(t *testing.T) {
+	app := New(nil, WithCDN())
+
+	url, err := app.asset("htmx.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "https://") {
+		t.Errorf("htmx.js is linked at %q, want its pinned CDN URL", url)
+	}
+}
@@ -0,0 +1,334 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/The-Skyscape/devtools/pkg/database"
+)
+
+// FieldErrors maps the name of each invalid field to its error
+type FieldErrors map[string]string
+
+func (errs FieldErrors) Error() string {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = errs[name]
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Get returns the error for the field, or an empty string
+func (errs FieldErrors) Get(name string) string {
+	return errs[name]
+}
+
+// bindState holds the values and errors of the last Bind for a
+// request, so templates can render them next to their inputs
+type bindState struct {
+	values   map[string]string
+	errors   FieldErrors
+	messages map[string]*MessageError
+}
+
+type bindKey struct{}
+
+// withBindState gives the request somewhere to record what was bound
+func withBindState(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), bindKey{}, &bindState{}))
+}
+
+func getBindState(r *http.Request) *bindState {
+	if r == nil {
+		return nil
+	}
+	state, _ := r.Context().Value(bindKey{}).(*bindState)
+	return state
+}
+
+// timeFormats are the formats accepted for time fields, from
+// date and datetime-local inputs to RFC 3339 in JSON bodies
+var timeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// Bind sets the fields of ent from the JSON body, form or query of the
+// request, then validates them with their validate tags, for example
+// `validate:"required,max=120,email"`. Only fields stored by the database
+// are bound, matched by name, snake case name or their form tag, and
+// fields tagged form:"-" are never bound. Validation errors are returned
+// as FieldErrors and shown by the field_error template func.
+func (c *BaseController) Bind(r *http.Request, ent any) error {
+	value := reflect.ValueOf(ent)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind expects a pointer to a struct, got %T", ent)
+	}
+
+	input, err := bindInput(r)
+	if err != nil {
+		return NewStatusError(http.StatusBadRequest, err)
+	}
+
+	errs := FieldErrors{}
+	values := map[string]string{}
+	messages := map[string]*MessageError{}
+	for _, field := range database.Columns(ent) {
+		name := field.Tag.Get("form")
+		if name == "-" {
+			continue
+		}
+
+		raw, ok := lookupInput(input, field.Name, name)
+		if ok {
+			values[field.Name] = raw
+			if err := setField(value.Elem().FieldByIndex(field.Index), raw); err != nil {
+				messages[field.Name] = NewMessageError("errors.invalid", "{field} {error}", "field", field.Name, "error", err)
+				errs[field.Name] = messages[field.Name].Error()
+				continue
+			}
+		}
+
+		if msg := validateField(field, value.Elem().FieldByIndex(field.Index)); msg != nil {
+			messages[field.Name] = msg
+			errs[field.Name] = msg.Error()
+		}
+	}
+
+	if state := getBindState(r); state != nil {
+		state.values, state.errors, state.messages = values, errs, messages
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// bindInput reads the request's values, decoding JSON bodies into
+// strings so they are converted the same way as form values
+func bindInput(r *http.Request) (map[string]string, error) {
+	input := map[string]string{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "application/json" {
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxJSONBody)).Decode(&body); err != nil {
+			return nil, err
+		}
+		for key, raw := range body {
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				input[key] = s
+			} else if string(raw) != "null" {
+				input[key] = string(raw)
+			}
+		}
+		for key, vals := range r.URL.Query() {
+			if _, ok := input[key]; !ok && len(vals) > 0 {
+				input[key] = vals[0]
+			}
+		}
+		return input, nil
+	}
+
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxJSONBody); err != nil {
+			return nil, err
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	for key, vals := range r.Form {
+		if len(vals) > 0 {
+			input[key] = vals[len(vals)-1]
+		}
+	}
+	return input, nil
+}
+
+// lookupInput finds a field's value by its form tag, its name in
+// any case, or its name in snake case like due_date for DueDate
+func lookupInput(input map[string]string, field, tag string) (string, bool) {
+	if tag != "" {
+		raw, ok := input[tag]
+		return raw, ok
+	}
+
+	if raw, ok := input[snakeCase(field)]; ok {
+		return raw, true
+	}
+
+	for key, raw := range input {
+		if strings.EqualFold(key, field) {
+			return raw, true
+		}
+	}
+	return "", false
+}
+
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 && !unicode.IsUpper(rune(name[i-1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// setField converts the raw value to the field's type
+func setField(field reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if raw == "" {
+			field.SetInt(0)
+			return nil
+		}
+		i, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if raw == "" {
+			field.SetUint(0)
+			return nil
+		}
+		u, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a positive whole number")
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if raw == "" {
+			field.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		switch strings.ToLower(raw) {
+		case "on", "true", "1", "yes":
+			field.SetBool(true)
+		case "", "off", "false", "0", "no":
+			field.SetBool(false)
+		default:
+			return fmt.Errorf("must be true or false")
+		}
+	case reflect.Struct:
+		if field.Type() != reflect.TypeFor[time.Time]() {
+			return fmt.Errorf("cannot be set")
+		}
+		if raw == "" {
+			field.Set(reflect.ValueOf(time.Time{}))
+			return nil
+		}
+		for _, layout := range timeFormats {
+			if t, err := time.Parse(layout, raw); err == nil {
+				field.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("must be a valid date")
+	default:
+		return fmt.Errorf("cannot be set")
+	}
+	return nil
+}
+
+// validateField checks the field's value against its validate tag
+// and returns a message for the first rule it breaks
+func validateField(field reflect.StructField, value reflect.Value) *MessageError {
+	tag := field.Tag.Get("validate")
+	if tag == "" {
+		return nil
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			if value.IsZero() {
+				return NewMessageError("errors.required", "{field} is required", "field", field.Name)
+			}
+		case "email":
+			if s := value.String(); s != "" {
+				if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+					return NewMessageError("errors.email", "{field} must be a valid email address", "field", field.Name)
+				}
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			size, length := measure(value)
+			if (name == "min" && size >= limit) || (name == "max" && size <= limit) {
+				continue
+			}
+
+			key, text := "errors."+name, "{field} must be at least {limit}"
+			if name == "max" {
+				text = "{field} must be at most {limit}"
+			}
+			if length {
+				key, text = key+"_length", text+" characters"
+			}
+			return NewMessageError(key, text, "field", field.Name, "limit", arg)
+		case "oneof":
+			if s := fmt.Sprint(value.Interface()); s != "" && !slices.Contains(strings.Fields(arg), s) {
+				return NewMessageError("errors.oneof", "{field} must be one of {options}",
+					"field", field.Name, "options", strings.Join(strings.Fields(arg), ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// measure returns the length of strings, reporting it is a length,
+// or the value of numbers
+func measure(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false
+	}
+	return 0, false
+}
@@ -0,0 +1,78 @@
+package application
+
+import (
+	"cmp"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/The-Skyscape/devtools/pkg/database"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// WithAutoTLS obtains and renews certificates for the given domains from
+// Let's Encrypt, answering HTTP-01 challenges on the unsecure server and
+// redirecting all other unsecure traffic to HTTPS, apart from /_health
+// and /_ready so they can be probed on localhost. Certificates are cached
+// in the data directory so restarts do not request new ones.
+//
+// CONGO_ACME_EMAIL sets the account contact and CONGO_ACME_DIRECTORY
+// points at a different ACME server, such as a local Pebble instance.
+func WithAutoTLS(domains ...string) Option {
+	return func(app *App) error {
+		client := app.acmeClient
+		if client == nil {
+			client = &acme.Client{
+				DirectoryURL: cmp.Or(os.Getenv("CONGO_ACME_DIRECTORY"), autocert.DefaultACMEDirectory),
+			}
+		}
+
+		app.certManager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(filepath.Join(database.DataDir(), "certs")),
+			Email:      os.Getenv("CONGO_ACME_EMAIL"),
+			Client:     client,
+		}
+		return nil
+	}
+}
+
+// WithACMEClient replaces the client used by WithAutoTLS, which allows
+// trusting the self-signed certificate of a test ACME server. It can
+// come before or after WithAutoTLS.
+func WithACMEClient(client *acme.Client) Option {
+	return func(app *App) error {
+		app.acmeClient = client
+		if app.certManager != nil {
+			app.certManager.Client = client
+		}
+		return nil
+	}
+}
+
+// redirectSecure sends the request to the same host and path over HTTPS,
+// except for the health and readiness probes, which are served as they
+// are made to localhost where no certificate can be issued
+func (app *App) redirectSecure(sslPort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_health" || r.URL.Path == "/_ready" {
+			app.ServeHTTP(w, r)
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if sslPort != "443" {
+			host = net.JoinHostPort(host, sslPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
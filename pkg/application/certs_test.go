@@ -0,0 +1,274 @@
+package application
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// stubACME is the smallest ACME server autocert completes an order
+// with: one account, one order and one http-01 challenge, validated
+// against the challenge server before the certificate is issued.
+type stubACME struct {
+	*httptest.Server
+	t         *testing.T
+	domain    string
+	challenge string // URL of the app's unsecure server
+
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	checked bool
+	valid   bool
+	cert    []byte
+}
+
+func newStubACME(t *testing.T, domain string) *stubACME {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "stub acme ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &stubACME{t: t, domain: domain, ca: ca, caKey: caKey, token: "stub-token"}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubACME) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprint(time.Now().UnixNano()))
+	payload := s.payload(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := "pending"
+	switch {
+	case s.valid:
+		status = "valid"
+	case s.checked:
+		status = "invalid"
+	}
+
+	switch r.URL.Path {
+	case "/dir":
+		s.reply(w, http.StatusOK, map[string]any{
+			"newNonce":   s.URL + "/nonce",
+			"newAccount": s.URL + "/account",
+			"newOrder":   s.URL + "/order",
+		})
+	case "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case "/account":
+		w.Header().Set("Location", s.URL+"/account/1")
+		s.reply(w, http.StatusCreated, map[string]any{"status": "valid"})
+	case "/order":
+		w.Header().Set("Location", s.URL+"/order/1")
+		s.reply(w, http.StatusCreated, s.order())
+	case "/order/1", "/finalize/1":
+		if r.URL.Path == "/finalize/1" {
+			s.issue(payload)
+		}
+		s.reply(w, http.StatusOK, s.order())
+	case "/authz/1":
+		s.reply(w, http.StatusOK, map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": s.domain},
+			"challenges": []map[string]string{s.http01(status)},
+		})
+	case "/chal/1":
+		s.checked, s.valid = true, s.validate()
+		s.reply(w, http.StatusOK, s.http01("processing"))
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(s.cert)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// payload decodes the body of a JWS request without checking its signature
+func (s *stubACME) payload(r *http.Request) []byte {
+	var jws struct{ Payload string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload
+}
+
+func (s *stubACME) reply(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *stubACME) order() map[string]any {
+	status := "pending"
+	switch {
+	case s.cert != nil:
+		status = "valid"
+	case s.valid:
+		status = "ready"
+	case s.checked:
+		status = "invalid"
+	}
+	order := map[string]any{
+		"status":         status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": s.domain}},
+		"authorizations": []string{s.URL + "/authz/1"},
+		"finalize":       s.URL + "/finalize/1",
+	}
+	if s.cert != nil {
+		order["certificate"] = s.URL + "/cert/1"
+	}
+	return order
+}
+
+func (s *stubACME) http01(status string) map[string]string {
+	return map[string]string{
+		"type":   "http-01",
+		"url":    s.URL + "/chal/1",
+		"token":  s.token,
+		"status": status,
+	}
+}
+
+// validate fetches the key authorization the app publishes for the token
+func (s *stubACME) validate() bool {
+	req, err := http.NewRequest("GET", s.challenge+"/.well-known/acme-challenge/"+s.token, nil)
+	if err != nil {
+		return false
+	}
+	req.Host = s.domain
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	return res.StatusCode == http.StatusOK && strings.HasPrefix(string(body), s.token+".")
+}
+
+// issue signs the certificate request of a finalized order
+func (s *stubACME) issue(payload []byte) {
+	var finalize struct{ CSR string }
+	if err := json.Unmarshal(payload, &finalize); err != nil || !s.valid {
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(finalize.CSR)
+	if err != nil {
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return
+	}
+
+	leaf, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: s.domain},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+
+	s.cert = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.Raw})...)
+}
+
+func TestAutoTLS(t *testing.T) {
+	t.Setenv("INTERNAL_DATA", t.TempDir())
+
+	const domain = "app.example.com"
+	ca := newStubACME(t, domain)
+
+	// The client comes first to check the order of options does not matter
+	app := New(nil,
+		WithACMEClient(&acme.Client{DirectoryURL: ca.URL + "/dir"}),
+		WithAutoTLS(domain))
+
+	unsecure := httptest.NewServer(app.certManager.HTTPHandler(app.redirectSecure("443")))
+	t.Cleanup(unsecure.Close)
+	ca.challenge = unsecure.URL
+
+	secure := httptest.NewUnstartedServer(app)
+	secure.TLS = app.certManager.TLSConfig()
+	secure.StartTLS()
+	t.Cleanup(secure.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.ca)
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: domain},
+		},
+	}
+
+	res, err := client.Get(secure.URL + "/_health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("health check over the issued certificate returned %d", res.StatusCode)
+	}
+
+	res, err = (&http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}).Get(unsecure.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMovedPermanently || !strings.HasPrefix(res.Header.Get("Location"), "https://") {
+		t.Errorf("unsecure request was answered with %d %q, want a redirect to https", res.StatusCode, res.Header.Get("Location"))
+	}
+}
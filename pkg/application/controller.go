@@ -3,6 +3,8 @@ package application
 import (
 	"bytes"
 	"cmp"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -33,6 +35,18 @@ func (base *BaseController) Use(name string) Controller {
 	return ctrl.Handle(base.Request)
 }
 
+// Context returns the context of the request being handled, so queries
+// made while rendering stop when the client goes away, or the background
+// context outside of a request
+//
+//	todos, err := models.Todos.Where("UserID", id).AllContext(c.Context())
+func (c *BaseController) Context() context.Context {
+	if c.Request == nil {
+		return context.Background()
+	}
+	return c.Request.Context()
+}
+
 func (c *BaseController) Atoi(name string, defaultValue int) int {
 	value := c.URL.Query().Get(name)
 	value = cmp.Or(value, c.FormValue(name))
@@ -52,15 +66,27 @@ func (c *BaseController) Refresh(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, c.URL.String(), http.StatusSeeOther)
 }
 
+// Redirect sends the client to the path. HTMX requests are redirected
+// with HX-Location, asking for the full page with the X-Full-Page header
+// as it replaces the body.
 func (c *BaseController) Redirect(w http.ResponseWriter, r *http.Request, path string) {
 	if htmx := r.Header.Get("HX-Request"); htmx != "" {
-		w.Header().Add("Hx-Location", c.hostPrefix+path)
+		location, _ := json.Marshal(map[string]any{
+			"path":    c.hostPrefix + path,
+			"target":  "body",
+			"headers": map[string]string{fullPageHeader: "true"},
+		})
+		w.Header().Add("Hx-Location", string(location))
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 	http.Redirect(w, r, path, http.StatusSeeOther)
 }
 
+// EventStream prepares the response for server sent events and returns a
+// function that renders a template and sends it to the client. Handlers
+// should return once r.Context() is done, which also happens when the
+// application is shutting down.
 func (c *BaseController) EventStream(w http.ResponseWriter, r *http.Request) (func(string, any), error) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -74,9 +100,20 @@ func (c *BaseController) EventStream(w http.ResponseWriter, r *http.Request) (fu
 	fmt.Fprintf(w, "event: ping\ndata: pong\n\n")
 	flusher.Flush()
 
+	// The stream is open until the handler returns, which ends the request
+	c.metrics.streams.Add(1)
+	context.AfterFunc(r.Context(), func() { c.metrics.streams.Add(-1) })
+
 	return func(template string, data any) {
+		if r.Context().Err() != nil {
+			return
+		}
+
 		var buf bytes.Buffer
-		c.Render(&buf, r, template, data)
+		if err := c.Render(&buf, r, template, data); err != nil {
+			log.Println("Failed to render event: ", template, err)
+			return
+		}
 		data = strings.ReplaceAll(buf.String(), "\n", "")
 		if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data); err != nil {
 			log.Println("Failed to flush: ", template, data)
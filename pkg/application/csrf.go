@@ -0,0 +1,157 @@
+package application
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	csrfCookie = "_csrf"
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+)
+
+var ErrInvalidCSRF = NewMessageError("errors.csrf", "invalid or missing csrf token")
+
+type csrfKey struct{}
+
+// WithCSRF exempts paths starting with one of the given prefixes from
+// CSRF protection, which every app has unless WithoutCSRF is used.
+// Unsafe requests must carry the session's CSRF token in the X-CSRF-Token
+// header or the csrf_token form field. Git pushes over HTTP and requests
+// with a Bearer token and no cookies are not checked, as browsers cannot
+// send either across sites. Every response carries the token in the
+// X-CSRF-Token header for JSON clients to send back.
+func WithCSRF(exempt ...string) Option {
+	return func(app *App) error {
+		app.csrfExempt = append(app.csrfExempt, exempt...)
+		return nil
+	}
+}
+
+// WithoutCSRF turns off CSRF protection, for apps that only serve
+// clients which do not keep cookies
+func WithoutCSRF() Option {
+	return func(app *App) error {
+		app.csrfDisabled = true
+		return nil
+	}
+}
+
+// setupCSRF signs tokens with CSRF_SECRET, falling back to AUTH_SECRET
+// and then to a random secret, and checks them on every route
+func (app *App) setupCSRF() error {
+	secret := cmp.Or(os.Getenv("CSRF_SECRET"), os.Getenv("AUTH_SECRET"))
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		secret = string(buf)
+	}
+
+	app.csrfSecret = []byte(secret)
+	app.UseMiddleware(app.csrf)
+	return nil
+}
+
+// csrf issues a session token when the client does not have one and
+// verifies the token on every request with an unsafe method
+func (app *App) csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var session string
+		if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+			session = cookie.Value
+		} else {
+			buf := make([]byte, 16)
+			rand.Read(buf)
+			session = hex.EncodeToString(buf)
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    session,
+				Path:     "/",
+				SameSite: http.SameSiteLaxMode,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+			})
+		}
+
+		token := app.csrfToken(session)
+		w.Header().Set(csrfHeader, token)
+		r = r.WithContext(context.WithValue(r.Context(), csrfKey{}, token))
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if csrfSafe(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, prefix := range app.csrfExempt {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		sent := cmp.Or(r.Header.Get(csrfHeader), r.PostFormValue(csrfField))
+		if !hmac.Equal([]byte(sent), []byte(token)) {
+			app.Error(w, r, http.StatusForbidden, ErrInvalidCSRF)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfSafe reports whether the request could not have been forged by
+// a browser. Browsers attach cached Basic credentials to cross-site form
+// posts, so only the git protocol's own content types and Bearer tokens
+// sent without cookies are trusted.
+func csrfSafe(r *http.Request) bool {
+	switch r.Header.Get("Content-Type") {
+	case "application/x-git-upload-pack-request", "application/x-git-receive-pack-request":
+		return true
+	}
+
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return strings.EqualFold(scheme, "Bearer") && len(r.Cookies()) == 0
+}
+
+// csrfToken signs the session so tokens cannot be forged from a cookie
+func (app *App) csrfToken(session string) string {
+	mac := hmac.New(sha256.New, app.csrfSecret)
+	mac.Write([]byte(session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CSRFToken returns the CSRF token for the request, or an
+// empty string when CSRF protection is turned off
+func CSRFToken(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+// csrfInput renders a hidden form field holding the CSRF token
+func csrfInput(r *http.Request) template.HTML {
+	token := CSRFToken(r)
+	if token == "" {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + csrfField + `" value="` + template.HTMLEscapeString(token) + `">`)
+}
@@ -0,0 +1,192 @@
+package application
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const flashCookie = "_flash"
+
+// Flash is a message shown once, on the next page the client loads
+type Flash struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Class returns the DaisyUI alert class for the flash's kind
+func (f Flash) Class() string {
+	switch f.Kind {
+	case "info", "success", "warning", "error":
+		return "alert-" + f.Kind
+	}
+	return "alert-info"
+}
+
+// FlashStore keeps flash messages between requests
+type FlashStore interface {
+	// Load returns the flashes saved for the client and removes them
+	Load(w http.ResponseWriter, r *http.Request) []Flash
+	// Save replaces the flashes saved for the client's next request
+	Save(w http.ResponseWriter, r *http.Request, flashes []Flash) error
+}
+
+// flashState holds the flashes of this request, taken from the
+// store the first time they are asked for, and the ones added
+// while handling it
+type flashState struct {
+	once    sync.Once
+	load    func(*http.Request) []Flash
+	loaded  []Flash
+	pending []Flash
+}
+
+type flashKey struct{}
+
+// WithFlashStore sets where flash messages are kept, which is a signed
+// cookie by default or the session once authentication is set up
+func WithFlashStore(store FlashStore) Option {
+	return func(app *App) error {
+		return app.WithFlashStore(store)
+	}
+}
+
+// WithFlashStore sets where flash messages are kept
+func (app *App) WithFlashStore(store FlashStore) error {
+	app.flashStore = store
+	return nil
+}
+
+// FlashStore returns where flash messages are kept
+func (app *App) FlashStore() FlashStore {
+	return app.flashStore
+}
+
+// Flash saves a message to show on the next page the client loads,
+// such as "Duck created" before redirecting. Kind is one of info,
+// success, warning or error.
+func (c *BaseController) Flash(w http.ResponseWriter, r *http.Request, kind, msg string) {
+	state, _ := r.Context().Value(flashKey{}).(*flashState)
+	if state == nil {
+		state = &flashState{}
+	}
+
+	state.pending = append(state.pending, Flash{Kind: kind, Message: msg})
+	if err := c.FlashStore().Save(w, r, state.pending); err != nil {
+		log.Print("Failed to save flash: ", err)
+	}
+}
+
+// Flashes returns the flash messages to show for the request, taking
+// them from the store the first time they are asked for. Rendering a
+// page takes them before anything is written, so the store can clear
+// them and they are only shown once.
+func Flashes(r *http.Request) []Flash {
+	if r == nil {
+		return nil
+	}
+	state, _ := r.Context().Value(flashKey{}).(*flashState)
+	if state == nil {
+		return nil
+	}
+
+	state.once.Do(func() {
+		if state.load != nil {
+			state.loaded = state.load(r)
+		}
+	})
+	return state.loaded
+}
+
+// withFlashes gives the request somewhere to keep its flashes. Only
+// requests that load a page can take them, and only when they are
+// asked for, so requests for assets, health checks and event streams
+// never touch the store.
+func (app *App) withFlashes(w http.ResponseWriter, r *http.Request) *http.Request {
+	state := &flashState{}
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && !IsPartial(r) {
+		state.load = func(r *http.Request) []Flash { return app.FlashStore().Load(w, r) }
+	}
+	return r.WithContext(context.WithValue(r.Context(), flashKey{}, state))
+}
+
+// CookieFlashes keeps flash messages in a cookie signed with the secret
+type CookieFlashes struct {
+	Secret []byte
+}
+
+// cookieFlashes signs flash cookies with AUTH_SECRET, or a random
+// secret that does not outlive the process when it is not set
+func cookieFlashes() *CookieFlashes {
+	secret := []byte(os.Getenv("AUTH_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &CookieFlashes{Secret: secret}
+}
+
+func (store *CookieFlashes) Load(w http.ResponseWriter, r *http.Request) []Flash {
+	cookie, err := r.Cookie(flashCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: flashCookie, Path: "/", MaxAge: -1})
+
+	payload, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(store.sign(payload))) {
+		return nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+
+	var flashes []Flash
+	json.Unmarshal(data, &flashes)
+	return flashes
+}
+
+func (store *CookieFlashes) Save(w http.ResponseWriter, r *http.Request, flashes []Flash) error {
+	data, err := json.Marshal(flashes)
+	if err != nil {
+		return err
+	}
+
+	// Flashing again in the same response replaces the earlier cookie
+	cookies := w.Header().Values("Set-Cookie")
+	w.Header().Del("Set-Cookie")
+	for _, c := range cookies {
+		if !strings.HasPrefix(c, flashCookie+"=") {
+			w.Header().Add("Set-Cookie", c)
+		}
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Value:    payload + "." + store.sign(payload),
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+	})
+	return nil
+}
+
+func (store *CookieFlashes) sign(payload string) string {
+	mac := hmac.New(sha256.New, store.Secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,85 @@
+package application
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// checkTimeout limits how long the readiness checks can take together
+const checkTimeout = 5 * time.Second
+
+// Check reports whether something the application depends on, like
+// the database, is working
+type Check func(context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// WithCheck adds a readiness check, reported by /_ready
+func WithCheck(name string, check Check) Option {
+	return func(app *App) error {
+		app.AddCheck(name, check)
+		return nil
+	}
+}
+
+// AddCheck adds a readiness check, reported by /_ready, such as
+// db.Ping or a repository's CheckWorkspaces
+func (app *App) AddCheck(name string, check Check) {
+	app.checks = append(app.checks, namedCheck{name, check})
+}
+
+// health reports that the application is up and serving requests
+func (app *App) health(w http.ResponseWriter, r *http.Request) {
+	app.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ready runs every check at once and responds with 503 Service
+// Unavailable when any of them fail or time out, listing each result
+func (app *App) ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	type result struct{ name, status string }
+	done := make(chan result, len(app.checks))
+	for _, c := range app.checks {
+		go func() {
+			if err := c.check(ctx); err != nil {
+				done <- result{c.name, err.Error()}
+				return
+			}
+			done <- result{c.name, "ok"}
+		}()
+	}
+
+	status, results := "ok", map[string]string{}
+	for _, c := range app.checks {
+		results[c.name] = "timed out"
+	}
+
+wait:
+	for range app.checks {
+		select {
+		case res := <-done:
+			results[res.name] = res.status
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	for _, res := range results {
+		if res != "ok" {
+			status = "unavailable"
+		}
+	}
+
+	code := http.StatusOK
+	if status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+
+	app.JSON(w, code, map[string]any{"status": status, "checks": results})
+}
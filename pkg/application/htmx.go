@@ -0,0 +1,135 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// fullPageHeader asks for a page with its layout on an HTMX request,
+// which Redirect sends as its HX-Location replaces the whole body
+const fullPageHeader = "X-Full-Page"
+
+// IsHTMX reports whether the request was made by HTMX
+func IsHTMX(r *http.Request) bool {
+	return r != nil && r.Header.Get("HX-Request") == "true"
+}
+
+// IsPartial reports whether the request swaps part of a page, so
+// pages can be rendered without their layout. Every HTMX request is
+// partial except boosted requests, history restores and redirects,
+// which replace the whole body.
+func IsPartial(r *http.Request) bool {
+	return IsHTMX(r) &&
+		r.Header.Get("HX-Boosted") != "true" &&
+		r.Header.Get(fullPageHeader) != "true" &&
+		r.Header.Get("HX-History-Restore-Request") != "true"
+}
+
+// RenderFragment renders one block of a page, such as a {{block "list" .}}
+// in todos.html, so HTMX requests can update part of a page from the
+// same template that renders all of it.
+func (app *App) RenderFragment(w io.Writer, r *http.Request, page, block string, data any) error {
+	return app.render(w, r, page, block, data)
+}
+
+// Fragment is a template rendered as an out of band swap
+type Fragment struct {
+	Template string
+	Data     any
+	Swap     string
+}
+
+// OOB creates an out of band fragment. Without a swap the template must
+// mark its own root element with hx-swap-oob, otherwise it is wrapped in
+// an element swapped with the given strategy, like "innerHTML:#stats".
+func OOB(template string, data any, swap ...string) Fragment {
+	f := Fragment{Template: template, Data: data}
+	if len(swap) > 0 {
+		f.Swap = swap[0]
+	}
+	return f
+}
+
+// RenderOOB appends out of band fragments to an HTMX response, after the
+// main content has been rendered. Other requests render nothing, as they
+// already receive the whole page.
+func (app *App) RenderOOB(w io.Writer, r *http.Request, fragments ...Fragment) error {
+	if !IsHTMX(r) {
+		return nil
+	}
+
+	for _, f := range fragments {
+		if f.Swap == "" {
+			if err := app.Render(w, r, f.Template, f.Data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := app.Render(&buf, r, f.Template, f.Data); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, `<div hx-swap-oob="%s">%s</div>`, template.HTMLEscapeString(f.Swap), buf.Bytes())
+	}
+	return nil
+}
+
+// Trigger sets the HX-Trigger header to fire client side events once the
+// response is swapped in. A detail is sent as the event's detail, which
+// switches the header to its JSON form.
+func (c *BaseController) Trigger(w http.ResponseWriter, event string, detail ...any) {
+	header := w.Header().Get("HX-Trigger")
+	if len(detail) == 0 && !strings.HasPrefix(header, "{") {
+		if header != "" {
+			header += ", "
+		}
+		w.Header().Set("HX-Trigger", header+event)
+		return
+	}
+
+	events := map[string]any{}
+	if strings.HasPrefix(header, "{") {
+		json.Unmarshal([]byte(header), &events)
+	} else if header != "" {
+		for _, name := range strings.Split(header, ",") {
+			events[strings.TrimSpace(name)] = nil
+		}
+	}
+
+	events[event] = nil
+	if len(detail) > 0 {
+		events[event] = detail[0]
+	}
+
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		return
+	}
+	w.Header().Set("HX-Trigger", string(encoded))
+}
+
+// Retarget swaps the response into the element matching the selector
+// instead of the request's hx-target
+func (c *BaseController) Retarget(w http.ResponseWriter, selector string) {
+	w.Header().Set("HX-Retarget", selector)
+}
+
+// Reswap changes how the response is swapped in, like "outerHTML"
+func (c *BaseController) Reswap(w http.ResponseWriter, swap string) {
+	w.Header().Set("HX-Reswap", swap)
+}
+
+// PushURL pushes the path, relative to the host prefix, into the
+// browser's history
+func (c *BaseController) PushURL(w http.ResponseWriter, path string) {
+	if strings.HasPrefix(path, "/") {
+		path = c.hostPrefix + path
+	}
+	w.Header().Set("HX-Push-Url", path)
+}
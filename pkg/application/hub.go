@@ -0,0 +1,323 @@
+package application
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHubHistory   = 100
+	defaultHubHeartbeat = 15 * time.Second
+	subscriberBuffer    = 32
+
+	// topicExpiry is how long a topic without subscribers keeps its
+	// events for clients to reconnect before it is forgotten
+	topicExpiry = time.Minute
+)
+
+// Hub broadcasts server sent events to every client subscribed to a
+// topic. Each topic keeps its latest events so reconnecting clients
+// receive what they missed, using the Last-Event-ID header.
+type Hub struct {
+	app       *App
+	history   int
+	heartbeat time.Duration
+
+	mu     sync.Mutex
+	lastID uint64
+	topics map[string]*hubTopic
+	conns  int
+	swept  time.Time
+}
+
+type hubTopic struct {
+	subs   map[*hubSubscriber]struct{}
+	events []hubEvent
+	idle   time.Time // when the last subscriber left
+}
+
+type hubEvent struct {
+	id   uint64
+	name string
+	data string
+}
+
+// hubSubscriber is one connected client, which is dropped when it
+// falls behind so it reconnects and replays what it missed
+type hubSubscriber struct {
+	events  chan hubEvent
+	dropped chan struct{}
+}
+
+// WithHub configures how many events each topic keeps for replay
+// and how often idle connections are sent a heartbeat, both of
+// which must be positive
+func WithHub(history int, heartbeat time.Duration) Option {
+	return func(app *App) error {
+		if history <= 0 {
+			return fmt.Errorf("hub history must be positive, got %d", history)
+		}
+		if heartbeat <= 0 {
+			return fmt.Errorf("hub heartbeat must be positive, got %s", heartbeat)
+		}
+
+		hub := app.Hub()
+		hub.history = history
+		hub.heartbeat = heartbeat
+		return nil
+	}
+}
+
+// Hub returns the application's event hub
+func (app *App) Hub() *Hub {
+	app.hubOnce.Do(func() {
+		app.hub = &Hub{
+			app:       app,
+			history:   defaultHubHistory,
+			heartbeat: defaultHubHeartbeat,
+			topics:    map[string]*hubTopic{},
+		}
+	})
+	return app.hub
+}
+
+// Subscribe streams the topics to the client until it disconnects or the
+// application shuts down. Events are named after their topic, so HTMX can
+// swap them with sse-swap="topic".
+func (hub *Hub) Subscribe(w http.ResponseWriter, r *http.Request, topics ...string) error {
+	return hub.subscribe(w, r, "", topics)
+}
+
+// SubscribeUser streams topics published for one user with PublishUser
+func (hub *Hub) SubscribeUser(w http.ResponseWriter, r *http.Request, userID string, topics ...string) error {
+	return hub.subscribe(w, r, userID, topics)
+}
+
+// Publish renders the template and sends it to every subscriber of the
+// topic. Templates are rendered once for all subscribers, without the
+// request of any one of them.
+func (hub *Hub) Publish(topic, template string, data any) error {
+	return hub.PublishUser("", topic, template, data)
+}
+
+// PublishUser renders the template and sends it to the user's
+// subscribers, sending nothing when the template cannot be rendered
+func (hub *Hub) PublishUser(userID, topic, template string, data any) error {
+	var buf bytes.Buffer
+	r, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+	if err := hub.app.Render(&buf, r, template, data); err != nil {
+		return err
+	}
+	hub.send(topicKey(topic, userID), topic, buf.String())
+	return nil
+}
+
+// Send sends raw data as a named event to every subscriber of the topic
+func (hub *Hub) Send(topic, event, data string) {
+	hub.send(topic, event, data)
+}
+
+func (hub *Hub) send(key, event, data string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.sweep()
+	hub.lastID++
+	e := hubEvent{id: hub.lastID, name: event, data: data}
+
+	t := hub.topic(key)
+	if t.events = append(t.events, e); len(t.events) > hub.history {
+		t.events = t.events[len(t.events)-hub.history:]
+	}
+
+	for sub := range t.subs {
+		select {
+		case sub.events <- e:
+		default:
+			hub.drop(sub)
+		}
+	}
+}
+
+// Connections returns the number of connected subscribers
+func (hub *Hub) Connections() int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return hub.conns
+}
+
+func (hub *Hub) subscribe(w http.ResponseWriter, r *http.Request, userID string, topics []string) error {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+
+	keys := make([]string, len(topics))
+	for i, topic := range topics {
+		keys[i] = topicKey(topic, userID)
+	}
+
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	sub, missed := hub.join(keys, lastID)
+	defer hub.leave(keys, sub)
+
+	for _, e := range missed {
+		writeEvent(w, e)
+	}
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(hub.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-sub.dropped:
+			return nil
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e := <-sub.events:
+			writeEvent(w, e)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return nil
+		}
+	}
+}
+
+// join adds a subscriber to the topics and returns the events after
+// lastID, under the same lock so no event is missed or sent twice
+func (hub *Hub) join(keys []string, lastID uint64) (*hubSubscriber, []hubEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	sub := &hubSubscriber{
+		events:  make(chan hubEvent, subscriberBuffer),
+		dropped: make(chan struct{}),
+	}
+
+	var missed []hubEvent
+	for _, key := range keys {
+		t := hub.topic(key)
+		t.subs[sub] = struct{}{}
+		if lastID == 0 {
+			continue
+		}
+		for _, e := range t.events {
+			if e.id > lastID {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	slices.SortFunc(missed, func(a, b hubEvent) int { return cmp.Compare(a.id, b.id) })
+	hub.conns++
+	return sub, missed
+}
+
+func (hub *Hub) leave(keys []string, sub *hubSubscriber) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for _, key := range keys {
+		t, ok := hub.topics[key]
+		if !ok {
+			continue
+		}
+		hub.unsubscribe(key, t, sub)
+	}
+	hub.conns--
+	hub.sweep()
+}
+
+// unsubscribe removes the subscriber from the topic, which is deleted
+// at once when it has no events to replay and expires otherwise
+func (hub *Hub) unsubscribe(key string, t *hubTopic, sub *hubSubscriber) {
+	if _, ok := t.subs[sub]; !ok {
+		return
+	}
+	delete(t.subs, sub)
+	if len(t.subs) > 0 {
+		return
+	}
+	if len(t.events) == 0 {
+		delete(hub.topics, key)
+		return
+	}
+	t.idle = time.Now()
+}
+
+// sweep deletes the topics that have had no subscribers for longer
+// than topicExpiry, such as those of users who have left, looking
+// at most once per expiry
+func (hub *Hub) sweep() {
+	now := time.Now()
+	if now.Sub(hub.swept) < topicExpiry {
+		return
+	}
+	hub.swept = now
+
+	for key, t := range hub.topics {
+		if len(t.subs) == 0 && now.Sub(t.idle) > topicExpiry {
+			delete(hub.topics, key)
+		}
+	}
+}
+
+// drop disconnects a subscriber that is not keeping up
+func (hub *Hub) drop(sub *hubSubscriber) {
+	for key, t := range hub.topics {
+		hub.unsubscribe(key, t, sub)
+	}
+	select {
+	case <-sub.dropped:
+	default:
+		close(sub.dropped)
+	}
+}
+
+func (hub *Hub) topic(key string) *hubTopic {
+	t, ok := hub.topics[key]
+	if !ok {
+		t = &hubTopic{subs: map[*hubSubscriber]struct{}{}, idle: time.Now()}
+		hub.topics[key] = t
+	}
+	return t
+}
+
+// topicKey scopes a topic to a user when one is given
+func topicKey(topic, userID string) string {
+	if userID == "" {
+		return topic
+	}
+	return topic + "@" + userID
+}
+
+// writeEvent writes an event in the text/event-stream format, with
+// every line of the data prefixed so multi-line HTML arrives intact
+func writeEvent(w io.Writer, e hubEvent) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\n", e.id, e.name)
+	for _, line := range strings.Split(strings.TrimSuffix(e.data, "\n"), "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
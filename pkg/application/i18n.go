@@ -0,0 +1,413 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"net/http"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// localeCookie remembers the locale chosen with SetLocale
+const localeCookie = "locale"
+
+// pluralForms names the plural forms in the order of plural.Form
+var pluralForms = [...]string{"other", "zero", "one", "two", "few", "many"}
+
+// LocaleFunc returns the locale preferred by the client making the
+// request, like a user's saved setting, or "" when it has none
+type LocaleFunc func(*http.Request) string
+
+// message is a translation, with a form for each plural category it
+// uses, or just "other" when it does not depend on a count
+type message map[string]string
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*m = message{"other": s}
+		return nil
+	}
+	return json.Unmarshal(data, (*map[string]string)(m))
+}
+
+// catalog holds the messages of every locale found in views/locales
+type catalog struct {
+	messages map[string]map[string]message
+	locales  []string
+	matcher  language.Matcher
+}
+
+// WithLocale sets the locale used when the client's locale has no
+// catalog, which is "en" by default
+func WithLocale(locale string) Option {
+	return func(app *App) error {
+		if _, err := language.Parse(locale); err != nil {
+			return err
+		}
+		app.locale = locale
+		return nil
+	}
+}
+
+// WithLocaleFunc adds a way to find the client's preferred locale,
+// checked before the locale cookie and the Accept-Language header
+func WithLocaleFunc(fn LocaleFunc) Option {
+	return func(app *App) error {
+		return app.WithLocaleFunc(fn)
+	}
+}
+
+// WithLocaleFunc adds a way to find the client's preferred locale
+func (app *App) WithLocaleFunc(fn LocaleFunc) error {
+	app.localeFuncs = append(app.localeFuncs, fn)
+	return nil
+}
+
+// readLocales reads the catalogs in views/locales, named by their locale
+// like es.json or pt-BR.json. Later sources override messages by key.
+func (app *App) readLocales() (*catalog, error) {
+	cat := &catalog{messages: map[string]map[string]message{app.locale: {}}}
+	for _, source := range app.views {
+		files, err := fs.Glob(source, "views/locales/*.json")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			locale := strings.TrimSuffix(path.Base(file), ".json")
+			if _, err := language.Parse(locale); err != nil {
+				return nil, fmt.Errorf("%s is not named after a locale: %w", file, err)
+			}
+
+			data, err := fs.ReadFile(source, file)
+			if err != nil {
+				return nil, err
+			}
+
+			var messages map[string]message
+			if err := json.Unmarshal(data, &messages); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+
+			if cat.messages[locale] == nil {
+				cat.messages[locale] = map[string]message{}
+			}
+			for key, msg := range messages {
+				cat.messages[locale][key] = msg
+			}
+		}
+	}
+
+	// The default locale comes first, the matcher falls back to it
+	for locale := range cat.messages {
+		if locale != app.locale {
+			cat.locales = append(cat.locales, locale)
+		}
+	}
+	slices.Sort(cat.locales)
+	cat.locales = append([]string{app.locale}, cat.locales...)
+
+	tags := make([]language.Tag, len(cat.locales))
+	for i, locale := range cat.locales {
+		tags[i] = language.Make(locale)
+	}
+	cat.matcher = language.NewMatcher(tags)
+
+	return cat, nil
+}
+
+// match returns the locale with a catalog that best serves the preferences
+func (cat *catalog) match(prefs ...language.Tag) (string, bool) {
+	if len(prefs) == 0 {
+		return "", false
+	}
+	_, i, confidence := cat.matcher.Match(prefs...)
+	return cat.locales[i], confidence != language.No
+}
+
+// translate formats the message for the key in the locale, falling back
+// to the default locale and then the key itself. Args are name and value
+// pairs, or just the count, which picks the plural form.
+func (cat *catalog) translate(locale, key string, args ...any) (string, error) {
+	text, ok, err := cat.lookup(locale, key, args...)
+	if err != nil || !ok {
+		return key, err
+	}
+	return text, nil
+}
+
+// lookup formats the message for the key like translate, reporting
+// whether any catalog has the key
+func (cat *catalog) lookup(locale, key string, args ...any) (string, bool, error) {
+	values, err := messageValues(key, args)
+	if err != nil {
+		return "", false, err
+	}
+
+	msg, ok := cat.messages[locale][key]
+	if !ok {
+		if msg, ok = cat.messages[cat.locales[0]][key]; !ok {
+			return "", false, nil
+		}
+		locale = cat.locales[0]
+	}
+
+	text := msg["other"]
+	if count, ok := values["count"]; ok {
+		text = msg.plural(locale, count)
+	}
+	return fillMessage(text, values), true, nil
+}
+
+// translateError translates errors by their MessageError key, and
+// shows any other error as it is since its text can hold data like
+// names or IDs that no catalog would have a message for
+func (cat *catalog) translateError(locale string, err error) string {
+	var msg *MessageError
+	if !errors.As(err, &msg) {
+		return err.Error()
+	}
+
+	if text, ok, err := cat.lookup(locale, msg.Key, msg.Args...); err == nil && ok {
+		return text
+	}
+	return msg.Error()
+}
+
+// translateFields translates each field error of a Bind by its message,
+// in the order of the field names like FieldErrors.Error
+func (cat *catalog) translateFields(locale string, errs FieldErrors, messages map[string]*MessageError) string {
+	names := slices.Sorted(maps.Keys(errs))
+	texts := make([]string, len(names))
+	for i, name := range names {
+		texts[i] = errs[name]
+		if msg, ok := messages[name]; ok {
+			texts[i] = cat.translateError(locale, msg)
+		}
+	}
+	return strings.Join(texts, ", ")
+}
+
+// messageValues reads args as a count or name and value pairs
+func messageValues(key string, args []any) (map[string]any, error) {
+	values := map[string]any{}
+	if len(args) == 1 {
+		values["count"] = args[0]
+		return values, nil
+	}
+
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("t %q: args must be a count or name and value pairs", key)
+	}
+	for i := 0; i < len(args); i += 2 {
+		name, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("t %q: arg %d must be a name", key, i)
+		}
+		values[name] = args[i+1]
+	}
+	return values, nil
+}
+
+// fillMessage replaces placeholders like {name} with their values
+func fillMessage(text string, values map[string]any) string {
+	for name, value := range values {
+		text = strings.ReplaceAll(text, "{"+name+"}", fmt.Sprint(value))
+	}
+	return text
+}
+
+// MessageError is an error shown to users, translated by its stable key
+// rather than its text, which can hold data like a field's name. Args are
+// name and value pairs filling placeholders like {field} in the text and
+// in the catalogs' messages.
+type MessageError struct {
+	Key  string
+	Text string
+	Args []any
+}
+
+// NewMessageError creates an error translated by its key, with
+// its text in the default language for logs and JSON clients
+func NewMessageError(key, text string, args ...any) *MessageError {
+	return &MessageError{Key: key, Text: text, Args: args}
+}
+
+func (e *MessageError) Error() string {
+	values, err := messageValues(e.Key, e.Args)
+	if err != nil {
+		return e.Text
+	}
+	return fillMessage(e.Text, values)
+}
+
+// plural picks the form for the count with the locale's plural rules,
+// preferring an explicit "zero" form for nothing in any language
+func (m message) plural(locale string, count any) string {
+	n, ok := toFloat(count)
+	if !ok {
+		return m["other"]
+	}
+
+	if text, ok := m["zero"]; ok && n == 0 {
+		return text
+	}
+
+	form := plural.Other
+	if n == math.Trunc(n) {
+		i := int(math.Abs(n))
+		form = plural.Cardinal.MatchPlural(language.Make(locale), i, 0, 0, 0, 0)
+	}
+
+	if text, ok := m[pluralForms[form]]; ok {
+		return text
+	}
+	return m["other"]
+}
+
+func toFloat(v any) (float64, bool) {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+// localeState caches the locale of a request once it is detected
+type localeState struct {
+	once   sync.Once
+	locale string
+}
+
+type localeKey struct{}
+
+// withLocaleState gives the request somewhere to cache its locale
+func withLocaleState(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), localeKey{}, &localeState{}))
+}
+
+// Locale returns the locale to respond in, from the first of the locale
+// funcs, the cookie set by SetLocale and the Accept-Language header that
+// has a catalog, or the default locale
+func (app *App) Locale(r *http.Request) string {
+	views, _ := app.templates()
+	if views == nil {
+		return app.locale
+	}
+	return app.localeOf(r, views.catalog)
+}
+
+// localeOf detects the locale of the request once, with the catalog of
+// the views rendering it
+func (app *App) localeOf(r *http.Request, cat *catalog) string {
+	if r == nil {
+		return app.locale
+	}
+
+	state, _ := r.Context().Value(localeKey{}).(*localeState)
+	if state == nil {
+		return app.detectLocale(r, cat)
+	}
+
+	state.once.Do(func() {
+		state.locale = app.detectLocale(r, cat)
+	})
+	return state.locale
+}
+
+func (app *App) detectLocale(r *http.Request, cat *catalog) string {
+	for _, fn := range app.localeFuncs {
+		if pref := fn(r); pref != "" {
+			if locale, ok := cat.match(language.Make(pref)); ok {
+				return locale
+			}
+		}
+	}
+
+	if cookie, err := r.Cookie(localeCookie); err == nil {
+		if locale, ok := cat.match(language.Make(cookie.Value)); ok {
+			return locale
+		}
+	}
+
+	prefs, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if locale, ok := cat.match(prefs...); ok {
+		return locale
+	}
+
+	return app.locale
+}
+
+// T translates the message for the request's locale, for text
+// written from Go like flash messages and errors
+func (app *App) T(r *http.Request, key string, args ...any) string {
+	views, _ := app.templates()
+	if views == nil {
+		return key
+	}
+
+	text, err := views.catalog.translate(app.localeOf(r, views.catalog), key, args...)
+	if err != nil {
+		return key
+	}
+	return text
+}
+
+// ErrUnsupportedLocale is returned by SetLocale for a locale without a catalog
+var ErrUnsupportedLocale = errors.New("unsupported locale")
+
+// Locales returns the locales with a catalog, the default locale first
+func (app *App) Locales() []string {
+	views, _ := app.templates()
+	if views == nil {
+		return []string{app.locale}
+	}
+	return slices.Clone(views.catalog.locales)
+}
+
+// SetLocale remembers the client's choice of locale in a cookie. The
+// locale must be served by one of the catalogs, so "es-MX" is saved as
+// "es" when there is an es.json, and any other is an ErrUnsupportedLocale.
+func (c *BaseController) SetLocale(w http.ResponseWriter, locale string) error {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrUnsupportedLocale, locale)
+	}
+
+	views, _ := c.templates()
+	if views == nil {
+		return fmt.Errorf("%w: %q", ErrUnsupportedLocale, locale)
+	}
+
+	matched, ok := views.catalog.match(tag)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnsupportedLocale, locale)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     localeCookie,
+		Value:    matched,
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
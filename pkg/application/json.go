@@ -0,0 +1,162 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxJSONBody limits the size of request bodies decoded as JSON
+const maxJSONBody = 1 << 20
+
+var (
+	ErrAccessDenied = NewMessageError("errors.access_denied", "access denied")
+	ErrNotFound     = NewMessageError("errors.not_found", "not found")
+)
+
+// StatusError is an error with the HTTP status it should be reported with
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+// NewStatusError pairs an error with an HTTP status
+func NewStatusError(status int, err error) *StatusError {
+	return &StatusError{Status: status, Err: err}
+}
+
+func (e *StatusError) Error() string { return e.Err.Error() }
+
+func (e *StatusError) Unwrap() error { return e.Err }
+
+// StatusOf returns the HTTP status for an error, which is 422 for
+// FieldErrors and 500 unless the error was created with NewStatusError
+func StatusOf(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Status
+	}
+	var fe FieldErrors
+	if errors.As(err, &fe) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// WantsJSON reports whether the client prefers JSON over HTML,
+// by comparing the quality of each in the Accept header
+func WantsJSON(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+
+	var jsonQ, htmlQ float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			q = v
+		}
+
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			jsonQ = max(jsonQ, q)
+		case mediaType == "text/html":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+
+	return jsonQ > 0 && jsonQ > htmlQ
+}
+
+// JSON writes v as a JSON response with the status. It is encoded
+// before anything is written, so values that cannot be encoded are
+// reported with a 500 Internal Server Error.
+func (app *App) JSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Print("Error encoding json: ", err)
+		status = http.StatusInternalServerError
+		body, _ = json.Marshal(newJSONError(status, errors.New("failed to encode response")))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// Error responds with the error and status, as a JSON error body
+// for JSON clients and the error-message template for the rest
+func (app *App) Error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if WantsJSON(r) {
+		app.JSON(w, status, newJSONError(status, err))
+		return
+	}
+
+	w.WriteHeader(status)
+	app.Render(w, r, "error-message", err)
+}
+
+// jsonError is the body of error responses sent to JSON clients
+type jsonError struct {
+	Status int         `json:"status"`
+	Error  string      `json:"error"`
+	Fields FieldErrors `json:"fields,omitempty"`
+}
+
+func newJSONError(status int, err error) jsonError {
+	body := jsonError{Status: status, Error: err.Error()}
+	errors.As(err, &body.Fields)
+	return body
+}
+
+// renderJSON responds to JSON clients with the data that would have been
+// rendered by the page, or with a JSON error when the data is an error
+func (app *App) renderJSON(w http.ResponseWriter, data any) {
+	if err, ok := data.(error); ok {
+		app.JSON(w, StatusOf(err), newJSONError(StatusOf(err), err))
+		return
+	}
+
+	app.JSON(w, http.StatusOK, data)
+}
+
+// Deny renders the page returned by a failed access check, or
+// responds with 401 Unauthorized to JSON clients
+func (app *App) Deny(w http.ResponseWriter, r *http.Request, page string) {
+	if WantsJSON(r) {
+		app.Error(w, r, http.StatusUnauthorized, ErrAccessDenied)
+		return
+	}
+
+	app.Render(w, r, page, nil)
+}
+
+// Decode reads the JSON request body into v. Errors are StatusErrors,
+// so they can be passed straight to Error or the error-message view.
+func (c *BaseController) Decode(w http.ResponseWriter, r *http.Request, v any) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, _ := mime.ParseMediaType(ct); mediaType != "application/json" {
+			return NewStatusError(http.StatusUnsupportedMediaType, errors.New("expected a json body"))
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBody)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return NewStatusError(http.StatusRequestEntityTooLarge, err)
+		}
+		return NewStatusError(http.StatusBadRequest, err)
+	}
+
+	return nil
+}
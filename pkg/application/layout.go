@@ -0,0 +1,265 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// layoutPage is a page rendered inside of a layout. Each page is
+// parsed into its own copy of the views, so blocks like "title"
+// can be defined by every page without colliding.
+type layoutPage struct {
+	set    *templateSet
+	name   string
+	layout string
+}
+
+// layoutDecl matches {{layout "name"}} as the first action of a page
+var layoutDecl = regexp.MustCompile(`^\s*\{\{-?\s*layout\s+"([^"]+)"\s*-?\}\}`)
+
+// viewFile is a parsed file from one of the view sources
+type viewFile struct {
+	source int
+	path   string
+	name   string // path within views without the extension
+	alias  string // file name, how views were named before namespaces
+	layout string
+	tmpl   *template.Template
+}
+
+// parseViews parses every html file under views/ at any depth. Each file is
+// named after its path, like "partials/todos-item", and also by its file name
+// when that is unambiguous. Later sources override templates of the same name,
+// while defining a name twice within one source is an error.
+func (app *App) parseViews() (*viewSet, error) {
+	funcs := template.FuncMap{
+		"req":         func() *http.Request { return nil },
+		"host":        func() string { return app.hostPrefix },
+		"path":        func(parts ...string) string { return fmt.Sprintf("/%s", strings.Join(parts, "/")) },
+		"asset":       app.asset,
+		"url":         func(name string, params ...any) (string, error) { return app.resolve(name, params...) },
+		"theme":       func() string { return app.theme },
+		"title":       func(title string) string { return strings.ReplaceAll(title, "_", " ") },
+		"prefix":      func(s, prefix string) bool { return strings.HasPrefix(s, prefix) },
+		"path_eq":     func(parts ...string) bool { return false },
+		"csrf":        func() string { return "" },
+		"csrf_field":  func() template.HTML { return "" },
+		"field_error": func(name string) string { return "" },
+		"field_value": func(name string) string { return "" },
+		"flashes":     func() []Flash { return nil },
+		"t":           func(key string, args ...any) string { return key },
+		"locale":      func() string { return app.locale },
+		"error_text":  func(err any) string { return fmt.Sprint(err) },
+		"layout":      func(name string) string { return "" },
+		"yield":       func(block ...string) template.HTML { return "" },
+	}
+
+	for name, fn := range app.funcs {
+		funcs[name] = fn
+	}
+
+	for name, ctrl := range app.controllers {
+		funcs[name] = func() Controller { return ctrl }
+	}
+
+	files, err := readViews(app.views, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		errs   []error
+		owners = map[string]*viewFile{}
+		base   = template.New("").Funcs(funcs)
+	)
+
+	// claim records which file defines a name, reporting names
+	// defined twice in one source and logging overrides
+	claim := func(name string, file *viewFile) bool {
+		if prev, ok := owners[name]; ok {
+			if prev.source == file.source {
+				errs = append(errs, fmt.Errorf("template %q is defined in both %s and %s", name, prev.path, file.path))
+				return false
+			}
+			log.Printf("Template %q in %s overrides %s", name, file.path, prev.path)
+		}
+		owners[name] = file
+		return true
+	}
+
+	// Links to unknown routes are reported now rather than when rendered
+	for _, file := range files {
+		for _, t := range file.tmpl.Templates() {
+			if t.Tree == nil {
+				continue
+			}
+			routeRefs(t.Tree.Root, func(name string) {
+				if _, ok := app.routes[name]; !ok {
+					errs = append(errs, fmt.Errorf("%s links to unknown route %q", file.path, name))
+				}
+			})
+		}
+	}
+
+	for _, file := range files {
+		if file.layout != "" {
+			claim(file.name, file)
+			continue
+		}
+
+		for _, t := range file.tmpl.Templates() {
+			if t.Tree == nil || !claim(t.Name(), file) {
+				continue
+			}
+			if _, err := base.AddParseTree(t.Name(), t.Tree); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	// Register file names as aliases of the namespaced names
+	named := map[string][]*viewFile{}
+	for _, file := range files {
+		if owners[file.name] == file {
+			named[file.alias] = append(named[file.alias], file)
+		}
+	}
+
+	aliases := map[string]string{}
+	for alias, files := range named {
+		file := files[len(files)-1]
+		if _, ok := owners[alias]; ok {
+			continue
+		}
+
+		if len(files) > 1 && files[len(files)-2].source == file.source {
+			log.Printf("View %q is ambiguous, render %q or %q instead", alias, files[len(files)-2].name, file.name)
+			continue
+		}
+
+		if file.layout != "" {
+			aliases[alias] = file.name
+			continue
+		}
+
+		if _, err := base.New(alias).Parse(`{{template "` + file.name + `" .}}`); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Pages with layouts get their own copy of the shared views
+	pages := map[string]*layoutPage{}
+	for _, file := range files {
+		if file.layout == "" || owners[file.name] != file {
+			continue
+		}
+
+		tmpl, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range file.tmpl.Templates() {
+			if t.Tree == nil {
+				continue
+			}
+			if _, err := tmpl.AddParseTree(t.Name(), t.Tree); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		page := &layoutPage{set: &templateSet{tmpl: tmpl}, name: file.name}
+		for _, layout := range []string{"layouts/" + file.layout, file.layout} {
+			if owner, ok := owners[layout]; ok && owner.layout == "" {
+				page.layout = layout
+				break
+			}
+		}
+
+		if page.layout == "" {
+			errs = append(errs, fmt.Errorf("%s uses unknown layout %q", file.path, file.layout))
+			continue
+		}
+
+		pages[file.name] = page
+	}
+
+	for alias, name := range aliases {
+		if page, ok := pages[name]; ok {
+			pages[alias] = page
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	cat, err := app.readLocales()
+	if err != nil {
+		return nil, err
+	}
+
+	return app.newViewSet(base, pages, cat), nil
+}
+
+// readViews parses each view file on its own, in source order
+func readViews(sources []fs.FS, funcs template.FuncMap) ([]*viewFile, error) {
+	var files []*viewFile
+	for i, source := range sources {
+		err := fs.WalkDir(source, "views", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && name == "views" {
+					return fs.SkipDir
+				}
+				return err
+			}
+
+			if d.IsDir() {
+				if name == "views/public" {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if path.Ext(name) != ".html" {
+				return nil
+			}
+
+			text, err := fs.ReadFile(source, name)
+			if err != nil {
+				return err
+			}
+
+			file := &viewFile{
+				source: i,
+				path:   name,
+				name:   strings.TrimSuffix(strings.TrimPrefix(name, "views/"), ".html"),
+				alias:  path.Base(name),
+			}
+
+			if m := layoutDecl.FindSubmatch(text); m != nil {
+				file.layout = string(m[1])
+			}
+
+			if file.tmpl, err = template.New(file.name).Funcs(funcs).Parse(string(text)); err != nil {
+				return err
+			}
+
+			files = append(files, file)
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
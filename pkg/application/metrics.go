@@ -0,0 +1,205 @@
+package application
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/database"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the histograms
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics collects the measurements served by /_metrics
+type metrics struct {
+	mu       sync.Mutex
+	requests map[requestLabels]uint64
+	latency  map[string]*histogram
+	renders  map[string]*histogram
+
+	// Streams opened with EventStream, which the hub does not count
+	streams atomic.Int64
+}
+
+type requestLabels struct {
+	route, method, status string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: map[requestLabels]uint64{},
+		latency:  map[string]*histogram{},
+		renders:  map[string]*histogram{},
+	}
+}
+
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// routeState records the pattern of the route that handled a request
+type routeState struct {
+	pattern string
+}
+
+type routeKey struct{}
+
+// trackRoute gives the request somewhere to record its route
+func trackRoute(r *http.Request) (*http.Request, *routeState) {
+	state := &routeState{}
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, state)), state
+}
+
+// routed records the route's pattern for the request's metrics
+func routed(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if state, ok := r.Context().Value(routeKey{}).(*routeState); ok {
+			state.pattern = pattern
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// observeRequest counts a request by its route, method and status
+func (m *metrics) observeRequest(route, method string, status int, d time.Duration) {
+	route = cmp.Or(route, "unmatched")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{route, method, strconv.Itoa(status)}]++
+	if m.latency[route] == nil {
+		m.latency[route] = &histogram{}
+	}
+	m.latency[route].observe(d.Seconds())
+}
+
+// observeRender times the rendering of a view
+func (m *metrics) observeRender(view string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.renders[view] == nil {
+		m.renders[view] = &histogram{}
+	}
+	m.renders[view].observe(d.Seconds())
+}
+
+// serveMetrics writes the metrics in the Prometheus text format. When
+// CONGO_METRICS_TOKEN is set it must be sent as a bearer token, and
+// without it only requests made on this machine are answered.
+func (app *App) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := os.Getenv("CONGO_METRICS_TOKEN"); token != "" {
+		sent := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	} else if !isLocal(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := app.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	header(w, "congo_http_requests_total", "counter", "Requests handled, by route, method and status.")
+	keys := make([]requestLabels, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b requestLabels) int {
+		return cmp.Or(cmp.Compare(a.route, b.route), cmp.Compare(a.method, b.method), cmp.Compare(a.status, b.status))
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "congo_http_requests_total{route=%s,method=%s,status=%s} %d\n",
+			quote(key.route), quote(key.method), quote(key.status), m.requests[key])
+	}
+
+	header(w, "congo_http_request_duration_seconds", "histogram", "Time taken to handle requests, by route.")
+	writeHistograms(w, "congo_http_request_duration_seconds", "route", m.latency)
+
+	header(w, "congo_view_render_duration_seconds", "histogram", "Time taken to render views, by view.")
+	writeHistograms(w, "congo_view_render_duration_seconds", "view", m.renders)
+
+	header(w, "congo_db_queries_total", "counter", "Database queries run.")
+	fmt.Fprintf(w, "congo_db_queries_total %d\n", database.Queries())
+
+	header(w, "congo_sse_connections", "gauge", "Clients subscribed to the hub or an event stream.")
+	fmt.Fprintf(w, "congo_sse_connections %d\n", int64(app.Hub().Connections())+app.metrics.streams.Load())
+
+	header(w, "go_goroutines", "gauge", "Goroutines that currently exist.")
+	fmt.Fprintf(w, "go_goroutines %d\n", runtime.NumGoroutine())
+}
+
+// isLocal reports whether the request comes from this machine and was
+// not forwarded by a proxy on behalf of another client
+func isLocal(r *http.Request) bool {
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistograms(w io.Writer, name, label string, hists map[string]*histogram) {
+	values := make([]string, 0, len(hists))
+	for value := range hists {
+		values = append(values, value)
+	}
+	slices.Sort(values)
+
+	for _, value := range values {
+		h, v := hists[value], quote(value)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s=%s,le=\"%g\"} %d\n", name, label, v, bound, h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s=%s,le=\"+Inf\"} %d\n", name, label, v, h.count)
+		fmt.Fprintf(w, "%s_sum{%s=%s} %g\n", name, label, v, h.sum)
+		fmt.Fprintf(w, "%s_count{%s=%s} %d\n", name, label, v, h.count)
+	}
+}
+
+// quote escapes a label value as the text format expects
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
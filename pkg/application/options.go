@@ -2,9 +2,13 @@ package application
 
 import (
 	"cmp"
-	"html/template"
+	"context"
 	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
 )
 
 // Option is a function that configures an Application
@@ -13,7 +17,25 @@ type Option func(*App) error
 // WithFunc adds a template function to the application
 func WithFunc(name string, fn any) Option {
 	return func(app *App) error {
-		app.viewEngine.Funcs(template.FuncMap{name: fn})
+		app.funcs[name] = fn
+		return nil
+	}
+}
+
+// WithDevMode reads the application's views from the views directory
+// on disk, under CONGO_VIEWS_DIR or the working directory, and parses
+// them again when they change. Parse errors are shown in the browser.
+// Setting CONGO_DEV enables dev mode without this option.
+func WithDevMode() Option {
+	return func(app *App) error {
+		root := cmp.Or(os.Getenv("CONGO_VIEWS_DIR"), ".")
+		if _, err := os.Stat(filepath.Join(root, "views")); err != nil {
+			return errors.Wrap(err, "dev mode needs a views directory")
+		}
+
+		log.Println("Dev mode: reloading views from", filepath.Join(root, "views"))
+		app.devMode = true
+		app.devViews = os.DirFS(root)
 		return nil
 	}
 }
@@ -36,6 +58,23 @@ func (app *App) WithController(name string, controller Controller) error {
 	return nil
 }
 
+// WithMiddleware adds middleware that wraps every route of the application
+func WithMiddleware(mw ...Middleware) Option {
+	return func(app *App) error {
+		app.UseMiddleware(mw...)
+		return nil
+	}
+}
+
+// WithRecovery renders panics with the error-message template
+// instead of dropping the connection
+func WithRecovery() Option {
+	return func(app *App) error {
+		app.UseMiddleware(app.Recover)
+		return nil
+	}
+}
+
 // WithViews adds views directory to application
 func WithViews(views fs.FS) Option {
 	return func(app *App) error {
@@ -64,3 +103,11 @@ func WithDaisyTheme(theme string) Option {
 		return nil
 	}
 }
+
+// WithShutdownHook registers a function to run when the application shuts down
+func WithShutdownHook(fn func(context.Context) error) Option {
+	return func(app *App) error {
+		app.OnShutdown(fn)
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package application
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/database"
+)
+
+// maxPageSize limits how many rows a client can ask for in one page
+const maxPageSize = 100
+
+// PathInt returns the path parameter, like {page} in "GET /docs/{page}",
+// as an int. Errors are 400 StatusErrors.
+func (c *BaseController) PathInt(r *http.Request, name string) (int, error) {
+	value := r.PathValue(name)
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, NewStatusError(http.StatusBadRequest, NewMessageError("errors.whole_number", "{name} must be a whole number", "name", name))
+	}
+	return i, nil
+}
+
+// PathID returns the path parameter holding an entity's ID, like {id}
+// in "DELETE /todos/{id}". Errors are 400 StatusErrors.
+func (c *BaseController) PathID(r *http.Request, name string) (string, error) {
+	id := strings.TrimSpace(r.PathValue(name))
+	if id == "" {
+		return "", NewStatusError(http.StatusBadRequest, NewMessageError("errors.missing", "missing {name}", "name", name))
+	}
+	return id, nil
+}
+
+// Entity loads the entity whose ID is in the path parameter. Missing
+// entities are 404 StatusErrors, so the error can be passed to Error or
+// returned from a view's Data func.
+//
+//	todo, err := application.Entity(r, models.Todos, "id")
+//	if err != nil {
+//		c.Error(w, r, application.StatusOf(err), err)
+//		return
+//	}
+func Entity[E database.Entity](r *http.Request, collection *database.Collection[E], name string) (E, error) {
+	var zero E
+	id := strings.TrimSpace(r.PathValue(name))
+	if id == "" {
+		return zero, NewStatusError(http.StatusBadRequest, NewMessageError("errors.missing", "missing {name}", "name", name))
+	}
+
+	ent, err := collection.GetContext(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return zero, NewStatusError(http.StatusNotFound, ErrNotFound)
+	}
+	if err != nil {
+		return zero, err
+	}
+	return ent, nil
+}
+
+// Pagination is the page of results a client asked for, from the page
+// and per_page query parameters, starting at page 1
+type Pagination struct {
+	Page int
+	Size int
+	More bool
+}
+
+// Paginate reads the page and per_page query parameters, using the size
+// when per_page is not given. Query with Limit and Offset and read the
+// rows with Iter.Page, which reports whether there is a next page:
+//
+//	p := c.Paginate(r, 20)
+//	p.More, err = db.Query(`SELECT ... LIMIT ? OFFSET ?`, p.Limit(), p.Offset()).
+//		Page(p.Size, func(scan database.ScanFunc) error { ... })
+func (c *BaseController) Paginate(r *http.Request, size int) Pagination {
+	p := Pagination{Page: 1, Size: size}
+	query := r.URL.Query()
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		p.Page = page
+	}
+	if per, err := strconv.Atoi(query.Get("per_page")); err == nil && per > 0 {
+		p.Size = per
+	}
+	p.Size = min(max(p.Size, 1), maxPageSize)
+	return p
+}
+
+// Limit is the number of rows to query, one more than the page size
+// so Iter.Page can tell whether there is a next page
+func (p Pagination) Limit() int {
+	return p.Size + 1
+}
+
+// Offset is the number of rows before the page
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.Size
+}
+
+// HasPrev reports whether there is a page before this one
+func (p Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+// Prev returns the number of the previous page
+func (p Pagination) Prev() int {
+	return max(p.Page-1, 1)
+}
+
+// Next returns the number of the next page
+func (p Pagination) Next() int {
+	return p.Page + 1
+}
@@ -0,0 +1,168 @@
+package application
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = NewMessageError("errors.rate_limited", "too many requests, try again later")
+
+// Limit is a token bucket holding Burst requests, refilled at Rate
+// requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerSecond allows n requests a second
+func PerSecond(n int) Limit { return Limit{Rate: float64(n), Burst: n} }
+
+// PerMinute allows n requests a minute, all at once if need be
+func PerMinute(n int) Limit { return Limit{Rate: float64(n) / 60, Burst: n} }
+
+// PerHour allows n requests an hour, all at once if need be
+func PerHour(n int) Limit { return Limit{Rate: float64(n) / 3600, Burst: n} }
+
+// RateStore keeps the token buckets of rate limits
+type RateStore interface {
+	// Take removes a token from the bucket for the key, after refilling
+	// it for the time since the last request. When it is empty it reports
+	// how long until the next token.
+	Take(key string, limit Limit, now time.Time) (ok bool, retry time.Duration, err error)
+}
+
+// KeyFunc identifies who a request is limited as, or returns ""
+// when it does not apply to the request
+type KeyFunc func(*http.Request) string
+
+// ByIP limits requests by the client's IP address
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ByBasicAuth limits requests by the username of their basic auth
+// credentials, like an access token ID. The username is not verified,
+// so it should only key routes that check credentials before the limit.
+func ByBasicAuth(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return "basic:" + user
+	}
+	return ""
+}
+
+// WithRateStore sets where rate limits are kept, in memory by default
+func WithRateStore(store RateStore) Option {
+	return func(app *App) error {
+		app.rateStore = store
+		return nil
+	}
+}
+
+// RateLimit returns middleware allowing each client the limit on a route,
+// identified by the first of the keys that applies or by IP otherwise.
+// Requests over the limit get 429 Too Many Requests rendered with the
+// error-message template.
+//
+//	app.Handle("POST /login", h, app.RateLimit(application.PerMinute(5)))
+func (app *App) RateLimit(limit Limit, keys ...KeyFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := ""
+			for _, fn := range keys {
+				if key = fn(r); key != "" {
+					break
+				}
+			}
+			if key == "" {
+				key = ByIP(r)
+			}
+
+			// Buckets are kept for each route, set by the router
+			// for middleware passed to Handle
+			ok, retry, err := app.rateStore.Take(r.Pattern+"|"+key, limit, time.Now())
+			if err != nil {
+				log.Print("Failed to check rate limit: ", err)
+				ok = true
+			}
+
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+				app.Error(w, r, http.StatusTooManyRequests, ErrRateLimited)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MemoryRates keeps token buckets in memory, for a single process
+type MemoryRates struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// NewMemoryRates creates an empty in memory rate store
+func NewMemoryRates() *MemoryRates {
+	return &MemoryRates{buckets: map[string]*bucket{}}
+}
+
+func (store *MemoryRates) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.sweep(now)
+
+	b, ok := store.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		store.buckets[key] = b
+	}
+
+	b.tokens = min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		if limit.Rate <= 0 {
+			return false, time.Hour, nil
+		}
+		return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second)), nil
+	}
+
+	b.tokens--
+	if limit.Rate > 0 {
+		b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)))
+	}
+	return true, 0, nil
+}
+
+// sweep forgets buckets that have refilled, at most once a minute,
+// as they are the same as a new bucket
+func (store *MemoryRates) sweep(now time.Time) {
+	if now.Sub(store.swept) < time.Minute {
+		return
+	}
+	store.swept = now
+
+	for key, b := range store.buckets {
+		if !b.full.IsZero() && now.After(b.full) {
+			delete(store.buckets, key)
+		}
+	}
+}
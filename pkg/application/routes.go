@@ -0,0 +1,147 @@
+package application
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"text/template/parse"
+
+	"github.com/The-Skyscape/devtools/pkg/database"
+)
+
+// Route is a pattern registered on the app's router
+type Route struct {
+	app     *App
+	pattern string
+}
+
+// Name names the route so links can be built from it with URLFor
+// or the url template func, such as "todos.delete". Names must be
+// unique within the application.
+func (route *Route) Name(name string) *Route {
+	if prev, ok := route.app.routes[name]; ok {
+		log.Fatalf("route %q already names %q", name, prev)
+	}
+	route.app.routes[name] = route.pattern
+	return route
+}
+
+// URLFor returns the path of the named route with its wildcards replaced
+// by the params in order, under the host prefix. Entities are replaced
+// by their ID. It panics when the route is unknown or the params do not
+// match, as links to missing routes are bugs. It is not named URL, which
+// controllers already have from their request.
+func (app *App) URLFor(name string, params ...any) string {
+	path, err := app.resolve(name, params...)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+// resolve builds the path of the named route
+func (app *App) resolve(name string, params ...any) (string, error) {
+	pattern, ok := app.routes[name]
+	if !ok {
+		return "", fmt.Errorf("unknown route %q", name)
+	}
+
+	// Patterns are "[METHOD ][HOST]/PATH", only the path is used
+	path := pattern[strings.Index(pattern, "/"):]
+
+	var (
+		segments = strings.Split(path, "/")
+		used     int
+	)
+
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+
+		wildcard := strings.Trim(segment, "{}")
+		if wildcard == "$" {
+			segments[i] = ""
+			continue
+		}
+
+		if used == len(params) {
+			return "", fmt.Errorf("route %q is missing {%s}", name, wildcard)
+		}
+
+		value := routeParam(params[used])
+		used++
+
+		if strings.HasSuffix(wildcard, "...") {
+			parts := strings.Split(value, "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i] = strings.Join(parts, "/")
+			continue
+		}
+
+		segments[i] = url.PathEscape(value)
+	}
+
+	if used < len(params) {
+		return "", fmt.Errorf("route %q takes %d params, got %d", name, used, len(params))
+	}
+
+	return app.hostPrefix + strings.Join(segments, "/"), nil
+}
+
+// routeParam formats a param for a path, using the ID of entities
+func routeParam(param any) string {
+	if ent, ok := param.(database.Entity); ok {
+		return ent.GetModel().ID
+	}
+	return fmt.Sprint(param)
+}
+
+// routeRefs finds the routes named by url calls in a template,
+// such as {{url "todos.delete" .ID}}
+func routeRefs(node parse.Node, found func(name string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			routeRefs(child, found)
+		}
+	case *parse.ActionNode:
+		routeRefs(n.Pipe, found)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			routeRefs(cmd, found)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) > 1 {
+			ident, ok := n.Args[0].(*parse.IdentifierNode)
+			name, literal := n.Args[1].(*parse.StringNode)
+			if ok && literal && ident.Ident == "url" {
+				found(name.Text)
+			}
+		}
+		for _, arg := range n.Args {
+			routeRefs(arg, found)
+		}
+	case *parse.IfNode:
+		routeRefs(&n.BranchNode, found)
+	case *parse.RangeNode:
+		routeRefs(&n.BranchNode, found)
+	case *parse.WithNode:
+		routeRefs(&n.BranchNode, found)
+	case *parse.BranchNode:
+		routeRefs(n.Pipe, found)
+		routeRefs(n.List, found)
+		routeRefs(n.ElseList, found)
+	case *parse.TemplateNode:
+		routeRefs(n.Pipe, found)
+	}
+}
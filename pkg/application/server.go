@@ -0,0 +1,142 @@
+package application
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// shutdownTimeout is how long the servers are given to drain
+// in-flight requests once the start context is cancelled
+const shutdownTimeout = 10 * time.Second
+
+// Start runs the application HTTP server and SSL server
+func (app *App) Start() error {
+	return app.StartContext(context.Background())
+}
+
+// StartContext runs the application HTTP server and SSL server until
+// the context is cancelled or a server fails, then shuts down gracefully
+func (app *App) StartContext(ctx context.Context) error {
+	log.Println("Starting Application...")
+
+	app.prepareViews()
+
+	// Every request context derives from the app's context so that
+	// long lived handlers, like event streams, are told to stop when
+	// the application begins shutting down.
+	ctx, app.cancel = context.WithCancel(ctx)
+	base := func(net.Listener) context.Context { return ctx }
+
+	errs := make(chan error, 2)
+	serve := func(listen func() error) {
+		if err := listen(); !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}
+
+	var handler http.Handler = app
+	sslPort := cmp.Or(os.Getenv("CONGO_SSL_PORT"), "443")
+	if app.certManager != nil {
+		secure := &http.Server{
+			Addr:        "0.0.0.0:" + sslPort,
+			Handler:     app,
+			BaseContext: base,
+			TLSConfig:   app.certManager.TLSConfig(),
+		}
+		app.servers = append(app.servers, secure)
+		log.Print("Serving Managed Secure Congo @ https://localhost:" + sslPort)
+		go serve(func() error { return secure.ListenAndServeTLS("", "") })
+
+		// The unsecure server only answers ACME challenges and
+		// probes, and redirects everything else to the secure server.
+		handler = app.certManager.HTTPHandler(app.redirectSecure(sslPort))
+	} else if cert, key, ok := certificates(); ok {
+		secure := &http.Server{Addr: "0.0.0.0:" + sslPort, Handler: app, BaseContext: base}
+		app.servers = append(app.servers, secure)
+		log.Print("Serving Secure Congo @ https://localhost:" + sslPort)
+		go serve(func() error { return secure.ListenAndServeTLS(cert, key) })
+	}
+
+	addr := "0.0.0.0:" + cmp.Or(os.Getenv("PORT"), "5000")
+	unsecure := &http.Server{Addr: addr, Handler: handler, BaseContext: base}
+	app.servers = append(app.servers, unsecure)
+	log.Print("Serving Unsecure Congo @ http://" + addr)
+	go serve(unsecure.ListenAndServe)
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return errors.Join(err, app.Shutdown(shutdownCtx))
+}
+
+// Shutdown stops accepting connections, waits for in-flight requests to
+// finish and then runs the registered shutdown hooks in reverse order
+func (app *App) Shutdown(ctx context.Context) error {
+	app.stopOnce.Do(func() {
+		defer close(app.stopped)
+		log.Println("Shutting down Application...")
+
+		if app.cancel != nil {
+			app.cancel()
+		}
+
+		var errs []error
+		for _, srv := range app.servers {
+			errs = append(errs, srv.Shutdown(ctx))
+		}
+
+		for i := len(app.hooks) - 1; i >= 0; i-- {
+			errs = append(errs, app.hooks[i](ctx))
+		}
+
+		app.stopErr = errors.Join(errs...)
+	})
+
+	select {
+	case <-app.stopped:
+		return app.stopErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OnShutdown registers a function to be called after the servers stop
+func (app *App) OnShutdown(fn func(context.Context) error) {
+	app.hooks = append(app.hooks, fn)
+}
+
+// Server prepares the views and returns the address and handler
+// for running the application with a custom http server
+func (app *App) Server() (string, http.Handler) {
+	app.prepareViews()
+	addr := "0.0.0.0:" + cmp.Or(os.Getenv("PORT"), "5000")
+	return addr, app
+}
+
+// certificates returns the SSL certificate and key paths when both exist
+func certificates() (cert, key string, ok bool) {
+	cert = cmp.Or(os.Getenv("CONGO_SSL_FULLCHAIN"), "/root/fullchain.pem")
+	if _, err := os.Stat(cert); err != nil {
+		log.Println("No SSL Certificate found at:", cert)
+		return "", "", false
+	}
+
+	key = cmp.Or(os.Getenv("CONGO_SSL_PRIVKEY"), "/root/privkey.pem")
+	if _, err := os.Stat(key); err != nil {
+		log.Println("No SSL Key found at:", key)
+		return "", "", false
+	}
+
+	return cert, key, true
+}
@@ -1,12 +1,17 @@
 package application
 
 import (
+	"bytes"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 //go:embed all:views
@@ -16,63 +21,295 @@ type View struct {
 	app         *App
 	name        string
 	accessCheck AccessCheck
+	data        func(*http.Request) (any, error)
 }
 
 func (app *App) Serve(name string, accessCheck AccessCheck) *View {
 	return &View{app: app, name: name, accessCheck: accessCheck}
 }
 
+// Data sets a function loading the data the view is rendered with,
+// which is also the response for clients that prefer JSON
+func (v *View) Data(fn func(*http.Request) (any, error)) *View {
+	v.data = fn
+	return v
+}
+
 func (v *View) Render(w http.ResponseWriter, r *http.Request, data any) {
 	v.app.Render(w, r, v.name, data)
 }
 
 func (v *View) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if v.accessCheck == nil {
+	if v.accessCheck != nil {
+		if page := v.accessCheck(v.app, r); page != "" {
+			v.app.Deny(w, r, page)
+			return
+		}
+	}
+
+	if v.data == nil {
 		v.app.Render(w, r, v.name, nil)
 		return
 	}
 
-	if page := v.accessCheck(v.app, r); page != "" {
-		v.app.Render(w, r, page, nil)
+	data, err := v.data(r)
+	if err != nil {
+		v.app.Error(w, r, StatusOf(err), err)
 		return
 	}
 
-	v.app.Render(w, r, v.name, nil)
+	v.app.Render(w, r, v.name, data)
 }
 
+// prepareViews parses the views, exiting when they are invalid
+// unless in dev mode, where the error is shown in the browser
+// and the views are parsed again whenever a file changes
 func (app *App) prepareViews() {
-	funcs := template.FuncMap{
-		"req":     func() *http.Request { return nil },
-		"host":    func() string { return app.hostPrefix },
-		"path":    func(parts ...string) string { return fmt.Sprintf("/%s", strings.Join(parts, "/")) },
-		"theme":   func() string { return app.theme },
-		"title":   func(title string) string { return strings.ReplaceAll(title, "_", " ") },
-		"prefix":  func(s, prefix string) bool { return strings.HasPrefix(s, prefix) },
-		"path_eq": func(parts ...string) bool { return false },
+	views, err := app.parseViews()
+	if err != nil && !app.devMode {
+		log.Fatal("Failed to parse views: ", err)
 	}
 
-	for name, ctrl := range app.controllers {
-		funcs[name] = func() Controller { return ctrl }
+	app.viewsMu.Lock()
+	app.viewEngine, app.viewErr = views, err
+	app.viewsMu.Unlock()
+
+	if app.devMode {
+		app.watchOnce.Do(func() { go app.watchViews() })
 	}
+}
+
+// watchViews polls the views for changes and parses them again,
+// keeping the last error so it can be rendered in the browser,
+// until the app is shut down
+func (app *App) watchViews() {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	last := app.viewsStamp()
+	for {
+		select {
+		case <-app.stopped:
+			return
+		case <-ticker.C:
+		}
+
+		if stamp := app.viewsStamp(); stamp != last {
+			last = stamp
+			log.Println("Views changed, reloading...")
+			views, err := app.parseViews()
+			if err != nil {
+				log.Println("Failed to parse views:", err)
+			}
 
-	if app.viewEngine == nil {
-		app.viewEngine = template.New("")
+			app.viewsMu.Lock()
+			if err == nil {
+				app.viewEngine = views
+			}
+			app.viewErr = err
+			app.viewsMu.Unlock()
+		}
 	}
+}
 
-	app.viewEngine = app.viewEngine.Funcs(funcs)
-	for _, source := range app.views {
-		if tmpl, err := app.viewEngine.ParseFS(source, "views/*.html"); err == nil {
-			app.viewEngine = tmpl
-		} else {
-			log.Fatal("Failed to parse root views", err)
+// viewsStamp summarises the views on disk by the number of files and
+// the latest modification time, so edits, additions and removals show
+func (app *App) viewsStamp() string {
+	if app.devViews == nil {
+		return ""
+	}
+
+	var (
+		count  int
+		latest time.Time
+	)
+
+	fs.WalkDir(app.devViews, "views", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
 		}
+		count++
+		return nil
+	})
+
+	return fmt.Sprintf("%d:%d", count, latest.UnixNano())
+}
+
+// templates returns the parsed views and the error from the last parse
+func (app *App) templates() (*viewSet, error) {
+	app.viewsMu.RLock()
+	defer app.viewsMu.RUnlock()
+	return app.viewEngine, app.viewErr
+}
+
+// viewSet is a parsed set of views. The shared views and each page with
+// a layout are cloned once at parse time into their own template set.
+type viewSet struct {
+	base    *templateSet
+	pages   map[string]*layoutPage
+	catalog *catalog
+}
+
+// templateSet is a copy of the views that is never executed, so renderers
+// can be cloned from it. Renderers are kept on a free list rather than a
+// sync.Pool, so they are not cloned again after every garbage collection,
+// and there are only as many as the most renders of the set at once.
+type templateSet struct {
+	tmpl *template.Template
+	mu   sync.Mutex
+	free []*renderer
+}
+
+// renderer is a clone of a template set whose request scoped funcs read
+// the request being rendered, it is only used by one render at a time
+type renderer struct {
+	*template.Template
+	views *viewSet
+	req   *http.Request
+
+	// The page being rendered is kept so its layout can yield to it
+	page *template.Template
+	data any
+}
 
-		if tmpl, err := app.viewEngine.ParseFS(source, "views/**/*.html"); err == nil {
-			app.viewEngine = tmpl
+func (app *App) newViewSet(base *template.Template, pages map[string]*layoutPage, cat *catalog) *viewSet {
+	return &viewSet{base: &templateSet{tmpl: base}, pages: pages, catalog: cat}
+}
+
+// get borrows a renderer for the page, from the page's own template set
+// when it has a layout or from the shared views otherwise
+func (views *viewSet) get(app *App, page string, r *http.Request) (*renderer, *templateSet) {
+	set := views.base
+	if p, ok := views.pages[page]; ok {
+		set = p.set
+	}
+
+	set.mu.Lock()
+	var rr *renderer
+	if n := len(set.free); n > 0 {
+		rr, set.free = set.free[n-1], set.free[:n-1]
+	}
+	set.mu.Unlock()
+
+	if rr == nil {
+		rr = &renderer{views: views}
+		clone, err := set.tmpl.Clone()
+		if err != nil {
+			log.Fatal("Failed to clone views: ", err)
 		}
+		rr.Template = clone.Funcs(app.requestFuncs(rr))
+	}
+
+	rr.req = r
+	return rr, set
+}
+
+func (set *templateSet) put(rr *renderer) {
+	rr.req, rr.page, rr.data = nil, nil, nil
+	set.mu.Lock()
+	set.free = append(set.free, rr)
+	set.mu.Unlock()
+}
+
+// lookup returns the template to execute for the page, which is the
+// page's layout when it declares one, or the named block of the page.
+// It returns nil when either the page or the block is not found.
+func (rr *renderer) lookup(name, block string, data any) *template.Template {
+	page, ok := rr.views.pages[name]
+	if !ok {
+		if block != "" && rr.Lookup(name) != nil {
+			return rr.Lookup(block)
+		}
+		return rr.Lookup(name)
+	}
+
+	if block != "" {
+		return rr.Lookup(block)
+	}
+
+	rr.page, rr.data = rr.Lookup(page.name), data
+	return rr.Lookup(page.layout)
+}
+
+// yield renders the body of the page being rendered by a layout,
+// or one of the page's blocks when named, which may be undefined
+func (rr *renderer) yield(block ...string) (template.HTML, error) {
+	if rr.page == nil {
+		return "", errors.New("yield called outside of a layout")
+	}
 
-		if tmpl, err := app.viewEngine.ParseFS(source, "views/**/**/*.html"); err == nil {
-			app.viewEngine = tmpl
+	tmpl := rr.page
+	if len(block) > 0 {
+		if tmpl = rr.page.Lookup(block[0]); tmpl == nil {
+			return "", nil
 		}
 	}
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, rr.data)
+	return template.HTML(buf.String()), err
+}
+
+// requestFuncs returns the funcs that depend on the request being
+// rendered, bound once to the renderer rather than on every render
+func (app *App) requestFuncs(rr *renderer) template.FuncMap {
+	funcs := template.FuncMap{
+		// {{req.URL.Query.Get "search"}}
+		"req": func() *http.Request { return rr.req },
+		// {{if path_eq "project" .ID "settings"}} ... {{end}}
+		"path_eq": func(parts ...string) bool {
+			path := fmt.Sprintf("/%s", strings.Join(parts, "/"))
+			return rr.req != nil && rr.req.URL.Path == path
+		},
+		// <form>{{csrf_field}}</form>
+		"csrf":       func() string { return CSRFToken(rr.req) },
+		"csrf_field": func() template.HTML { return csrfInput(rr.req) },
+		// {{field_error "Title"}} and {{field_value "Title"}} after Bind
+		"field_error": func(name string) string {
+			if state := getBindState(rr.req); state != nil {
+				if msg, ok := state.messages[name]; ok {
+					return rr.views.catalog.translateError(app.localeOf(rr.req, rr.views.catalog), msg)
+				}
+				return state.errors[name]
+			}
+			return ""
+		},
+		"field_value": func(name string) string {
+			if state := getBindState(rr.req); state != nil {
+				return state.values[name]
+			}
+			return ""
+		},
+		"flashes": func() []Flash { return Flashes(rr.req) },
+		// {{t "todos.count" 3}} or {{t "greeting" "name" .Name}}
+		"t": func(key string, args ...any) (string, error) {
+			return rr.views.catalog.translate(app.localeOf(rr.req, rr.views.catalog), key, args...)
+		},
+		"locale": func() string { return app.localeOf(rr.req, rr.views.catalog) },
+		// {{error_text .}} translates an error by its key, or shows it as it is
+		"error_text": func(err any) string {
+			e, ok := err.(error)
+			if !ok {
+				return fmt.Sprint(err)
+			}
+
+			locale := app.localeOf(rr.req, rr.views.catalog)
+			var fields FieldErrors
+			if state := getBindState(rr.req); state != nil && errors.As(e, &fields) {
+				return rr.views.catalog.translateFields(locale, fields, state.messages)
+			}
+			return rr.views.catalog.translateError(locale, e)
+		},
+		// {{yield}} or {{yield "title"}} inside of a layout
+		"yield": rr.yield,
+	}
+
+	for name, ctrl := range app.controllers {
+		funcs[name] = func() Controller { return ctrl.Handle(rr.req) }
+	}
+
+	return funcs
 }
@@ -0,0 +1,114 @@
+package application
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type benchController struct {
+	BaseController
+}
+
+func (c benchController) Handle(r *http.Request) Controller {
+	c.Request = r
+	return &c
+}
+
+func (c *benchController) Name() string {
+	return c.URL.Query().Get("name")
+}
+
+// benchApp parses a page inside of a layout and the same page without
+// one, each reading its request through controllers
+func benchApp() *App {
+	views := fstest.MapFS{
+		"views/layouts/main.html": {Data: []byte(`<html><body>{{yield}}</body></html>`)},
+		"views/page.html": {Data: []byte(`{{layout "main"}}
+<h1>Hello, {{c0.Name}}</h1>
+<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>`)},
+		"views/plain.html": {Data: []byte(`<html><body>
+<h1>Hello, {{c0.Name}}</h1>
+<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>
+</body></html>`)},
+	}
+
+	opts := []Option{}
+	for i := range 8 {
+		opts = append(opts, WithController(fmt.Sprintf("c%d", i), &benchController{}))
+	}
+
+	app := New(views, opts...)
+	app.Server()
+	return app
+}
+
+// BenchmarkRender renders a page inside of its layout from many goroutines at once
+func BenchmarkRender(b *testing.B) {
+	app := benchApp()
+	data := []string{"one", "two", "three"}
+	r := httptest.NewRequest(http.MethodGet, "/?name=world", nil)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			app.Render(io.Discard, r, "page", data)
+		}
+	})
+}
+
+// BenchmarkRenderPlain renders a page without a layout, for comparison
+// with BenchmarkRenderSharedFuncs
+func BenchmarkRenderPlain(b *testing.B) {
+	app := benchApp()
+	data := []string{"one", "two", "three"}
+	r := httptest.NewRequest(http.MethodGet, "/?name=world", nil)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			app.Render(io.Discard, r, "plain", data)
+		}
+	})
+}
+
+// BenchmarkRenderSharedFuncs renders the page of BenchmarkRenderPlain the
+// way views were rendered before renderers, building the request funcs on
+// every render and setting them on the shared views. Concurrent renders
+// can see each other's request, so it only measures the cost.
+func BenchmarkRenderSharedFuncs(b *testing.B) {
+	app := benchApp()
+	views, err := app.templates()
+	if err != nil {
+		b.Fatal(err)
+	}
+	shared, err := views.base.tmpl.Clone()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	data := []string{"one", "two", "three"}
+	r := httptest.NewRequest(http.MethodGet, "/?name=world", nil)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			funcs := template.FuncMap{
+				"req":  func() *http.Request { return r },
+				"host": func() string { return app.hostPrefix },
+				"path_eq": func(parts ...string) bool {
+					return r.URL.Path == "/"+strings.Join(parts, "/")
+				},
+			}
+			for name, ctrl := range app.controllers {
+				funcs[name] = func() Controller { return ctrl.Handle(r) }
+			}
+			shared.Lookup("plain").Funcs(funcs).Execute(io.Discard, data)
+		}
+	})
+}
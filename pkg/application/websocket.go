@@ -0,0 +1,247 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+// maxSocketMessage limits the size of messages read from clients
+const maxSocketMessage = 1 << 20
+
+// Socket is an open WebSocket connection, messages from the client
+// are dispatched to the controller and templates are pushed back
+type Socket struct {
+	app  *App
+	req  *http.Request
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+// Message is a message sent by the client, either JSON with an "action"
+// field or the form values of an HTMX ws-send element, where the action
+// falls back to the name or id of the element that sent it
+type Message struct {
+	Action  string
+	Headers map[string]string
+	fields  map[string]json.RawMessage
+	raw     []byte
+}
+
+// WebSocket upgrades the request and dispatches every message to the exported
+// method of the controller named by the message's action, which must have the
+// signature func(*Socket, *Message) error. Methods are called on the controller
+// handling this request, so the current user is known as with any page. The
+// socket also receives the events published to the topics on the Hub.
+func (c *BaseController) WebSocket(w http.ResponseWriter, r *http.Request, topics ...string) {
+	ctrl := c.controller()
+	if ctrl == nil {
+		log.Println("WebSocket called from an unregistered controller")
+		http.Error(w, "websocket not available", http.StatusInternalServerError)
+		return
+	}
+
+	if _, ok := w.(http.Hijacker); !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = maxSocketMessage
+			ws := &Socket{app: c.App, req: r, conn: conn}
+			ws.serve(ctrl, topics)
+		},
+	}
+
+	server.ServeHTTP(w, r)
+}
+
+// controller finds the registered controller embedding this BaseController
+func (c *BaseController) controller() Controller {
+	for _, ctrl := range c.controllers {
+		v := reflect.ValueOf(ctrl)
+		if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+			continue
+		}
+
+		base := v.Elem().FieldByName("BaseController")
+		if base.IsValid() && base.Type() == reflect.TypeFor[BaseController]() &&
+			base.Addr().Interface() == c {
+			return ctrl
+		}
+	}
+	return nil
+}
+
+// sameOrigin rejects connections from pages served by other sites,
+// as browsers send cookies with cross site WebSocket requests
+func sameOrigin(config *websocket.Config, r *http.Request) (err error) {
+	if config.Origin, err = websocket.Origin(config, r); err != nil {
+		return err
+	}
+	if config.Origin == nil || config.Origin.Host != r.Host {
+		return errors.New("cross origin websocket rejected")
+	}
+	return nil
+}
+
+func (ws *Socket) serve(ctrl Controller, topics []string) {
+	handlers := socketHandlers(ctrl.Handle(ws.req))
+
+	// Connections are closed when the application shuts down,
+	// as hijacked connections are not closed by the server
+	go func() {
+		<-ws.req.Context().Done()
+		ws.conn.Close()
+	}()
+
+	if len(topics) > 0 {
+		go ws.forward(topics)
+	}
+
+	for {
+		var raw []byte
+		if err := websocket.Message.Receive(ws.conn, &raw); err != nil {
+			return
+		}
+
+		msg, err := parseMessage(raw)
+		if err != nil {
+			log.Println("Invalid websocket message: ", err)
+			continue
+		}
+
+		handler, ok := handlers[strings.ToLower(msg.Action)]
+		if !ok {
+			log.Printf("No websocket handler for %q", msg.Action)
+			continue
+		}
+
+		// Each message is handled by a controller bound to the socket's request
+		fn := reflect.ValueOf(ctrl.Handle(ws.req)).Method(handler)
+		if err := fn.Interface().(func(*Socket, *Message) error)(ws, msg); err != nil {
+			log.Printf("Websocket handler %q failed: %v", msg.Action, err)
+		}
+	}
+}
+
+// forward sends the hub's events for the topics until the socket closes
+func (ws *Socket) forward(topics []string) {
+	hub := ws.app.Hub()
+	sub, _ := hub.join(topics, 0)
+	defer hub.leave(topics, sub)
+
+	for {
+		select {
+		case <-ws.req.Context().Done():
+			return
+		case <-sub.dropped:
+			return
+		case e := <-sub.events:
+			if err := ws.send(e.data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// socketHandlers finds the methods of the controller that handle
+// messages, mapping their lower case names to the method index
+func socketHandlers(ctrl Controller) map[string]int {
+	handlers := map[string]int{}
+	t := reflect.TypeOf(ctrl)
+	for i := range t.NumMethod() {
+		method := t.Method(i).Type
+		if method.NumIn() == 3 && method.NumOut() == 1 &&
+			method.In(1) == reflect.TypeFor[*Socket]() &&
+			method.In(2) == reflect.TypeFor[*Message]() &&
+			method.Out(0) == reflect.TypeFor[error]() {
+			handlers[strings.ToLower(t.Method(i).Name)] = i
+		}
+	}
+	return handlers
+}
+
+func parseMessage(raw []byte) (*Message, error) {
+	msg := &Message{raw: raw}
+	if err := json.Unmarshal(raw, &msg.fields); err != nil {
+		return nil, err
+	}
+
+	if headers, ok := msg.fields["HEADERS"]; ok {
+		json.Unmarshal(headers, &msg.Headers)
+		delete(msg.fields, "HEADERS")
+	}
+
+	msg.Action = msg.Value("action")
+	for _, header := range []string{"HX-Trigger-Name", "HX-Trigger"} {
+		if msg.Action == "" {
+			msg.Action = msg.Headers[header]
+		}
+	}
+
+	return msg, nil
+}
+
+// Value returns a field of the message as a string
+func (msg *Message) Value(name string) string {
+	raw, ok := msg.fields[name]
+	if !ok {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// Decode unmarshals the message into v
+func (msg *Message) Decode(v any) error {
+	return json.Unmarshal(msg.raw, v)
+}
+
+// Request returns the request that opened the socket
+func (ws *Socket) Request() *http.Request {
+	return ws.req
+}
+
+// Render renders the template with the socket's request and sends it,
+// HTMX swaps it into the element with the same id as its root element
+func (ws *Socket) Render(template string, data any) error {
+	var buf bytes.Buffer
+	if err := ws.app.Render(&buf, ws.req, template, data); err != nil {
+		return err
+	}
+	return ws.send(buf.String())
+}
+
+// SendJSON sends v encoded as JSON
+func (ws *Socket) SendJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.send(string(data))
+}
+
+// Close closes the connection
+func (ws *Socket) Close() error {
+	return ws.conn.Close()
+}
+
+func (ws *Socket) send(data string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return websocket.Message.Send(ws.conn, data)
+}
@@ -1,7 +1,7 @@
 package authentication
 
 import (
-	"errors"
+	"context"
 	"fmt"
 
 	"github.com/The-Skyscape/devtools/pkg/database"
@@ -30,21 +30,31 @@ type Collection struct {
 	Sessions *database.Collection[*Session]
 }
 
-func (c *Collection) GetUser(ident string) (*User, error) {
-	return database.Cursor(c.db, new(User), `
+// In returns the collection running in the transaction
+func (c *Collection) In(tx *database.DynamicDB) *Collection {
+	return &Collection{
+		db:       tx,
+		Users:    c.Users.In(tx),
+		Sessions: c.Sessions.In(tx),
+	}
+}
+
+// GetUser finds a user by their ID, email or handle
+func (c *Collection) GetUser(ctx context.Context, ident string) (*User, error) {
+	return database.CursorContext(ctx, c.db, new(User), `
 
 		WHERE ID = $1 OR Email = $1 OR Handle = $1
 	
 	`, ident).One()
 }
 
-func (c *Collection) Signup(name, email, handle, password string, isAdmin bool) (*User, error) {
+func (c *Collection) Signup(ctx context.Context, name, email, handle, password string, isAdmin bool) (*User, error) {
 	passhash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.Users.Insert(&User{
+	return c.Users.InsertContext(ctx, &User{
 		Avatar:   fmt.Sprintf("https://robohash.org/%s?set=set4", email),
 		Name:     name,
 		Email:    email,
@@ -54,13 +64,13 @@ func (c *Collection) Signup(name, email, handle, password string, isAdmin bool)
 	})
 }
 
-func (c *Collection) Signin(ident string, password string) (user *User, err error) {
-	if user, err = c.GetUser(ident); err != nil {
-		return nil, errors.New("user not found")
+func (c *Collection) Signin(ctx context.Context, ident string, password string) (user *User, err error) {
+	if user, err = c.GetUser(ctx, ident); err != nil {
+		return nil, ErrUserNotFound
 	}
 
 	if !user.VerifyPassword(password) {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 
 	return user, nil
@@ -1,11 +1,20 @@
 package authentication
 
 import (
+	"database/sql"
 	"errors"
 	"net/http"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/database"
+)
+
+// Errors shown by the sign in and sign up forms, translated by their keys
+var (
+	ErrMissingFields   = application.NewMessageError("auth.errors.missing_fields", "missing required fields")
+	ErrUserNotFound    = application.NewMessageError("auth.errors.user_not_found", "user not found")
+	ErrInvalidPassword = application.NewMessageError("auth.errors.invalid_password", "invalid password")
 )
 
 func (c *Collection) Controller(opts ...Option) *Controller {
@@ -15,6 +24,7 @@ func (c *Collection) Controller(opts ...Option) *Controller {
 		setupView:    "signup.html",
 		signinView:   "signin.html",
 		signoutRedir: "/",
+		attemptLimit: application.PerMinute(10),
 	}
 
 	for _, opt := range opts {
@@ -43,6 +53,9 @@ type Controller struct {
 
 	// Signout functions
 	signoutRedir string
+
+	// Signin and signup attempts allowed for each client
+	attemptLimit application.Limit
 }
 
 func (auth *Controller) Optional(app *application.App, r *http.Request) string {
@@ -75,9 +88,27 @@ func (auth *Controller) AdminOnly(app *application.App, r *http.Request) string
 
 func (auth *Controller) Setup(app *application.App) {
 	auth.BaseController.Setup(app)
-	http.HandleFunc("POST /_auth/signup", auth.HandleSignup)
-	http.HandleFunc("POST /_auth/signin", auth.HandleSignin)
-	http.HandleFunc("POST /_auth/signout", auth.HandleSignout)
+	app.WithFlashStore(&sessionFlashes{auth, app.FlashStore()})
+	app.WithLocaleFunc(auth.userLocale)
+	app.HandleFunc("POST /_auth/signup", auth.HandleSignup, app.RateLimit(auth.attemptLimit))
+	app.HandleFunc("POST /_auth/signin", auth.HandleSignin, app.RateLimit(auth.attemptLimit))
+	app.HandleFunc("POST /_auth/signout", auth.HandleSignout)
+}
+
+// ByUser limits requests by the signed in user, for use with RateLimit
+func (auth *Controller) ByUser(r *http.Request) string {
+	if user, _, err := auth.Authenticate(r); err == nil && user != nil {
+		return "user:" + user.ID
+	}
+	return ""
+}
+
+// userLocale returns the locale saved by the signed in user
+func (auth *Controller) userLocale(r *http.Request) string {
+	if user, _, err := auth.Authenticate(r); err == nil && user != nil {
+		return user.Locale
+	}
+	return ""
 }
 
 func (auth Controller) Handle(r *http.Request) application.Controller {
@@ -112,17 +143,25 @@ func (auth *Controller) CurrentUser() *User {
 func (auth Controller) HandleSignup(w http.ResponseWriter, r *http.Request) {
 	name, handle, email, password := r.FormValue("name"), r.FormValue("handle"), r.FormValue("email"), r.FormValue("password")
 	if name == "" || handle == "" || email == "" || password == "" {
-		auth.Render(w, r, "error-message", errors.New("missing required fields"))
+		auth.Render(w, r, "error-message", application.NewStatusError(http.StatusBadRequest, ErrMissingFields))
 		return
 	}
 
-	user, err := auth.Signup(name, email, handle, password, auth.Users.Count() == 0)
-	if err != nil {
-		auth.Render(w, r, "error-message", err)
-		return
-	}
-
-	session, err := auth.Sessions.Insert(&Session{UserID: user.ID})
+	// The user is only created along with their session, and the
+	// first user to sign up is the only admin
+	var (
+		user    *User
+		session *Session
+	)
+	err := auth.db.Tx(r.Context(), func(tx *database.DynamicDB) (err error) {
+		users := auth.In(tx)
+		first := users.Users.CountContext(r.Context()) == 0
+		if user, err = users.Signup(r.Context(), name, email, handle, password, first); err != nil {
+			return err
+		}
+		session, err = users.Sessions.InsertContext(r.Context(), &Session{UserID: user.ID})
+		return err
+	})
 	if err != nil {
 		auth.Render(w, r, "error-message", err)
 		return
@@ -155,18 +194,21 @@ func (auth Controller) HandleSignup(w http.ResponseWriter, r *http.Request) {
 func (auth Controller) HandleSignin(w http.ResponseWriter, r *http.Request) {
 	handle, password := r.FormValue("handle"), r.FormValue("password")
 
-	user, err := auth.GetUser(handle)
+	user, err := auth.GetUser(r.Context(), handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUserNotFound
+	}
 	if err != nil {
-		auth.Render(w, r, "error-message", err)
+		auth.Render(w, r, "error-message", application.NewStatusError(http.StatusUnauthorized, err))
 		return
 	}
 
 	if !user.VerifyPassword(password) {
-		auth.Render(w, r, "error-message", errors.New("invalid password"))
+		auth.Render(w, r, "error-message", application.NewStatusError(http.StatusUnauthorized, ErrInvalidPassword))
 		return
 	}
 
-	session, err := auth.Sessions.Insert(&Session{UserID: user.ID})
+	session, err := auth.Sessions.InsertContext(r.Context(), &Session{UserID: user.ID})
 	if err != nil {
 		auth.Render(w, r, "error-message", err)
 		return
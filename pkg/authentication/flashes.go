@@ -0,0 +1,46 @@
+package authentication
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// sessionFlashes keeps flash messages with the signed in user's
+// session, falling back to the app's store for everyone else
+type sessionFlashes struct {
+	auth     *Controller
+	fallback application.FlashStore
+}
+
+func (store *sessionFlashes) Load(w http.ResponseWriter, r *http.Request) []application.Flash {
+	flashes := store.fallback.Load(w, r)
+
+	session, err := store.auth.sessionFrom(r)
+	if err != nil || session.Flashes == "" {
+		return flashes
+	}
+
+	var saved []application.Flash
+	json.Unmarshal([]byte(session.Flashes), &saved)
+
+	session.Flashes = ""
+	store.auth.Sessions.UpdateContext(r.Context(), session)
+	return append(flashes, saved...)
+}
+
+func (store *sessionFlashes) Save(w http.ResponseWriter, r *http.Request, flashes []application.Flash) error {
+	session, err := store.auth.sessionFrom(r)
+	if err != nil {
+		return store.fallback.Save(w, r, flashes)
+	}
+
+	data, err := json.Marshal(flashes)
+	if err != nil {
+		return err
+	}
+
+	session.Flashes = string(data)
+	return store.auth.Sessions.UpdateContext(r.Context(), session)
+}
@@ -4,6 +4,8 @@ import (
 	"cmp"
 	"log"
 	"net/http"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
 )
 
 type Option func(*Controller)
@@ -40,6 +42,14 @@ func WithSigninView(view, dest string) Option {
 	}
 }
 
+// WithAttemptLimit sets how often each client can try to sign in
+// or sign up, which is 10 times a minute by default
+func WithAttemptLimit(limit application.Limit) Option {
+	return func(auth *Controller) {
+		auth.attemptLimit = limit
+	}
+}
+
 func WithSignoutURL(url string) Option {
 	if url == "" {
 		log.Fatal("cannot have empty signout redirect url")
@@ -1,6 +1,7 @@
 package authentication
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"github.com/The-Skyscape/devtools/pkg/database"
@@ -13,7 +14,10 @@ func (*Session) Table() string { return "sessions" }
 
 type Session struct {
 	database.Model
-	UserID string
+	UserID  string
+	Flashes string
+
+	User *User `belongs_to:"UserID"`
 }
 
 func (s *Session) Token() (string, error) {
@@ -25,34 +29,39 @@ func (s *Session) Token() (string, error) {
 }
 
 func (auth *Controller) Authenticate(r *http.Request) (*User, *Session, error) {
-	cookie, err := r.Cookie(auth.cookieName)
+	session, err := auth.sessionFrom(r)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	user, err := auth.GetUser(r.Context(), session.UserID)
+	return user, session, err
+}
+
+// sessionFrom returns the session for the request's cookie
+func (auth *Controller) sessionFrom(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(auth.cookieName)
+	if err != nil {
+		return nil, err
+	}
+
 	token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (any, error) {
 		return []byte(os.Getenv("AUTH_SECRET")), nil
 	})
 
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, nil, err
+		return nil, errors.New("invalid token claims")
 	}
 
 	sessionID, ok := claims["sub"].(string)
 	if !ok {
-		return nil, nil, err
-	}
-
-	session, err := auth.Sessions.Get(sessionID)
-	if err != nil {
-		return nil, nil, err
+		return nil, errors.New("invalid token subject")
 	}
 
-	user, err := auth.GetUser(session.UserID)
-	return user, session, err
+	return auth.Sessions.GetContext(r.Context(), sessionID)
 }
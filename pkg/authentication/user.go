@@ -1,6 +1,8 @@
 package authentication
 
 import (
+	"context"
+
 	"github.com/The-Skyscape/devtools/pkg/database"
 
 	"golang.org/x/crypto/bcrypt"
@@ -9,7 +11,7 @@ import (
 func (*User) Table() string { return "users" }
 
 type User struct {
-	*Collection
+	*Collection `json:"-"`
 
 	database.Model
 	Avatar   string
@@ -17,16 +19,17 @@ type User struct {
 	Email    string
 	Handle   string
 	IsAdmin  bool
-	PassHash []byte
+	PassHash []byte `json:"-"`
+	Locale   string
 }
 
-func (user *User) SetupPassword(password string) (err error) {
+func (user *User) SetupPassword(ctx context.Context, password string) (err error) {
 	user.PassHash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
-	return user.Users.Update(user)
+	return user.Users.UpdateContext(ctx, user)
 }
 
 func (user *User) VerifyPassword(password string) bool {
@@ -3,6 +3,7 @@ package authentication
 import (
 	"context"
 	"net/http"
+
 	"github.com/The-Skyscape/devtools/pkg/application"
 )
 
@@ -36,20 +37,32 @@ func (auth *Controller) Serve(name string, adminOnly bool) http.Handler {
 }
 
 func (auth *Controller) Protect(fn http.Handler, adminOnly bool) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if auth.setupView != "" && auth.Users.Count() == 0 {
-			auth.App.Render(w, r, auth.setupView, nil)
-			return
-		}
-		user, s, _ := auth.Authenticate(r)
-		if user == nil || (adminOnly && !user.IsAdmin) {
-			auth.App.Render(w, r, auth.signinView, "")
-			return
-		}
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, sessionKey, s)
-		ctx = context.WithValue(ctx, userKey, user)
-		fn.ServeHTTP(w, r.WithContext(ctx))
+	return auth.Access(adminOnly)(fn).ServeHTTP
+}
+
+// Access returns middleware that requires a signed in user, or an
+// admin, and stores the user and session in the request context
+func (auth *Controller) Access(adminOnly bool) application.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.setupView != "" && auth.Users.Count() == 0 {
+				auth.App.Render(w, r, auth.setupView, nil)
+				return
+			}
+			user, s, _ := auth.Authenticate(r)
+			if user == nil || (adminOnly && !user.IsAdmin) {
+				if application.WantsJSON(r) {
+					auth.App.Error(w, r, http.StatusUnauthorized, application.ErrAccessDenied)
+					return
+				}
+				auth.App.Render(w, r, auth.signinView, "")
+				return
+			}
+			ctx := r.Context()
+			ctx = context.WithValue(ctx, sessionKey, s)
+			ctx = context.WithValue(ctx, userKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
 	}
 }
 
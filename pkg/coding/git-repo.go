@@ -9,8 +9,10 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"github.com/The-Skyscape/devtools/pkg/database"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -22,6 +24,8 @@ type GitRepo struct {
 	Description string
 	Visibility  string
 	UserID      string // Owner of the repository
+
+	Owner *authentication.User `belongs_to:"UserID"`
 }
 
 func (r *Repository) NewRepo(repoID, name string) (repo *GitRepo, err error) {
@@ -32,23 +36,36 @@ func (r *Repository) NewRepo(repoID, name string) (repo *GitRepo, err error) {
 	} else {
 		model = r.repos.DB.NewModel(repoID)
 	}
-	
-	repo, err = r.repos.Insert(&GitRepo{
+
+	if model.ID == "" {
+		model.ID = uuid.NewString()
+	}
+
+	repo = &GitRepo{
 		Model:      model,
 		Name:       name,
 		Visibility: "private",
 		UserID:     "", // Will be set by the caller
-	})
-	if err != nil {
-		return nil, err
 	}
 
+	// The repo is initialized on disk before it is saved, rather than
+	// in a transaction that would hold the database while git runs,
+	// and removed again when it cannot be saved
 	if err = os.Mkdir(repo.Path(), 0755); err != nil {
 		return nil, err
 	}
 
-	_, _, err = repo.Run("init", "--bare")
-	return repo, err
+	if _, _, err = repo.Run("init", "--bare"); err != nil {
+		os.RemoveAll(repo.Path())
+		return nil, errors.Wrap(err, "failed to initialize repo")
+	}
+
+	if _, err = r.repos.Insert(repo); err != nil {
+		os.RemoveAll(repo.Path())
+		return nil, err
+	}
+
+	return repo, nil
 }
 
 func (r *Repository) GetRepo(id string) (*GitRepo, error) {
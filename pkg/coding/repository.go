@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"path/filepath"
 
+	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"github.com/The-Skyscape/devtools/pkg/database"
 
@@ -44,7 +45,7 @@ func (repo *Repository) GitServer(auth *authentication.Controller) http.Handler
 			return true, nil
 		}
 
-		if user, err := auth.GetUser(creds.Username); err != nil {
+		if user, err := auth.GetUser(req.Context(), creds.Username); err != nil {
 			return false, errors.New("invalid username or password")
 		} else if ok := user.VerifyPassword(creds.Password); !ok {
 			return false, errors.New("invalid username or password")
@@ -57,9 +58,12 @@ func (repo *Repository) GitServer(auth *authentication.Controller) http.Handler
 		log.Fatal("Failed to setup git server: ", err)
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// Clients are limited by their IP, as the credentials they send
+	// are only verified after the limit is taken
+	limit := auth.RateLimit(application.PerMinute(60))
+	return limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		git.ServeHTTP(w, r)
-	})
+	}))
 }
 
 func (repo *Repository) Workspace(auth *authentication.Controller) http.Handler {
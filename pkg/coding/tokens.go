@@ -10,7 +10,7 @@ import (
 func (*AccessToken) Table() string { return "code_access_tokens" }
 
 type AccessToken struct {
-	*Repository
+	*Repository `json:"-"`
 
 	database.Model
 	Secret  string
@@ -2,7 +2,8 @@ package coding
 
 import (
 	"bytes"
-	"cmp"
+	"context"
+	"database/sql"
 	_ "embed"
 	"fmt"
 	"log"
@@ -28,9 +29,15 @@ type Workspace struct {
 	Port   int
 	Ready  bool
 	RepoID string
+
+	GitRepo *GitRepo `belongs_to:"RepoID"`
 }
 
+// Repo returns the workspace's repo, unless it was preloaded
 func (w *Workspace) Repo() (*GitRepo, error) {
+	if w.GitRepo != nil {
+		return w.GitRepo, nil
+	}
 	return w.repo.repos.Get(w.RepoID)
 }
 
@@ -65,23 +72,49 @@ func (w *Workspace) Service() *containers.Service {
 }
 
 func (r *Repository) GetWorkspace(name string) (*Workspace, error) {
-	w, err := r.spaces.Search(`WHERE Name = ?`, name)
-	if err != nil || len(w) == 0 {
-		return nil, cmp.Or(err, errors.New("workspace not found"))
+	w, err := r.spaces.Where("Name", name).First()
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("workspace not found")
+	} else if err != nil {
+		return nil, err
 	}
 
-	w[0].repo = r
-	return w[0], nil
+	w.repo = r
+	return w, nil
 }
 
 func (r *Repository) Workspaces() ([]*Workspace, error) {
-	ws, err := r.spaces.Search(``)
+	ws, err := r.spaces.Preload("GitRepo").All()
 	for _, w := range ws {
 		w.repo = r
 	}
 	return ws, err
 }
 
+// CheckWorkspaces reports workspaces that were started but whose
+// containers are no longer running, a readiness check
+func (r *Repository) CheckWorkspaces(ctx context.Context) error {
+	ws, err := r.spaces.SearchContext(ctx, ``)
+	if err != nil {
+		return err
+	}
+
+	var stopped []string
+	for _, w := range ws {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if w.Ready && !w.Service().IsRunning() {
+			stopped = append(stopped, w.Name)
+		}
+	}
+
+	if len(stopped) > 0 {
+		return errors.Errorf("workspaces not running: %s", strings.Join(stopped, ", "))
+	}
+	return nil
+}
+
 //go:embed resources/prepare-workspace.sh
 var prepareWorkspace string
 
@@ -17,7 +17,7 @@ type Database interface {
 }
 
 type Model struct {
-	DB        Database
+	DB        Database `json:"-"`
 	ID        string
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -2,8 +2,10 @@ package database
 
 import (
 	"cmp"
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
 	"log"
 	"reflect"
 	"strings"
@@ -16,6 +18,10 @@ type DynamicDB struct {
 	Database
 	Ents  []Entity
 	Repos map[string]*Collection[Entity]
+
+	// Schema changes allowed by Register
+	rebuilds bool
+	dryRun   bool
 }
 
 type Entity interface {
@@ -24,7 +30,7 @@ type Entity interface {
 }
 
 func Dynamic(engine Database, opts ...DynamicDBOption) *DynamicDB {
-	db := DynamicDB{engine, []Entity{}, map[string]*Collection[Entity]{}}
+	db := DynamicDB{Database: engine, Ents: []Entity{}, Repos: map[string]*Collection[Entity]{}}
 	for _, opt := range opts {
 		opt(&db)
 	}
@@ -49,15 +55,31 @@ func (db *DynamicDB) NewModel(id string) Model {
 	return Model{db, id, time.Now(), time.Now()}
 }
 
+// Ping checks the connection to the database, a readiness check
+func (db *DynamicDB) Ping(ctx context.Context) error {
+	if pinger, ok := db.Database.(interface{ PingContext(context.Context) error }); ok {
+		return pinger.PingContext(ctx)
+	}
+	return db.QueryContext(ctx, "SELECT 1").Exec()
+}
+
+// Close closes the underlying database engine when it supports closing
+func (db *DynamicDB) Close() error {
+	if closer, ok := db.Database.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Register reconciles the entity's table with its fields, creating the
+// table and adding columns as needed. Changing the type of columns,
+// dropping them and declaring foreign keys on existing columns needs the
+// table rebuilt, which is only done WithRebuilds.
 func (db *DynamicDB) Register(ent Entity) error {
-	if err := db.Query(`
-		CREATE TABLE IF NOT EXISTS ` + ent.Table() + ` (
-			ID        TEXT PRIMARY KEY,
-			CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			UpdatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-	`).Exec(); err != nil {
-		return errors.Wrap(err, "failed to create table")
+	for _, registered := range db.Ents {
+		if registered.Table() == ent.Table() {
+			return nil
+		}
 	}
 
 	kind := reflect.ValueOf(ent).Kind()
@@ -65,37 +87,58 @@ func (db *DynamicDB) Register(ent Entity) error {
 		return errors.New("expected struct, got " + kind.String())
 	}
 
-	fields, types, defaults := db.Fields(ent)
-	for i, field := range fields {
-		db.Query(fmt.Sprintf(`
-			ALTER TABLE %s ADD COLUMN %s %s DEFAULT %v
-		`, ent.Table(), field, types[i], defaults[i])).Exec()
+	// Registered before its relations, which can lead back to it
+	db.Ents = append(db.Ents, ent)
+
+	plan, err := db.plan(ent)
+	if err != nil {
+		return err
 	}
 
-	db.Ents = append(db.Ents, ent)
-	return nil
+	if err := db.migrate(plan); err != nil || db.dryRun {
+		return err
+	}
+
+	rels, err := relations(ent)
+	if err != nil {
+		return err
+	}
+	return db.index(ent, rels)
 }
 
-func (db *DynamicDB) Fields(ent Entity) (fields []string, types []string, defaults []string) {
-	value := reflect.ValueOf(ent)
-	if value.Kind() == reflect.Ptr {
-		value = value.Elem()
+// Columns returns the struct fields of an entity that are stored as
+// columns, skipping the embedded Model and fields that cannot be stored
+func Columns(ent any) (columns []reflect.StructField) {
+	type_ := reflect.TypeOf(ent)
+	if type_ == nil {
+		return
+	}
+	if type_.Kind() == reflect.Ptr {
+		type_ = type_.Elem()
 	}
-	if value.Kind() != reflect.Struct {
+	if type_.Kind() != reflect.Struct {
 		return
 	}
 
-	type_ := value.Type()
 	for i := range type_.NumField() {
 		field := type_.Field(i)
 		kind := field.Type.Kind()
-		if field.Anonymous || kind == reflect.Ptr || kind == reflect.Interface ||
-			kind == reflect.Func || kind == reflect.Struct {
+		if field.Anonymous || !field.IsExported() || kind == reflect.Ptr || kind == reflect.Interface ||
+			kind == reflect.Func || (kind == reflect.Struct && field.Type != timeType) || field.Tag.Get("has_many") != "" {
 			continue
 		}
+		columns = append(columns, field)
+	}
+
+	return
+}
+
+var timeType = reflect.TypeOf(time.Time{})
 
+func (db *DynamicDB) Fields(ent Entity) (fields []string, types []string, defaults []string) {
+	for _, field := range Columns(ent) {
 		fields = append(fields, field.Name)
-		switch kind {
+		switch kind := field.Type.Kind(); kind {
 		case reflect.String:
 			types = append(types, "TEXT")
 			defaults = append(defaults, cmp.Or(field.Tag.Get("default"), "''"))
@@ -109,6 +152,10 @@ func (db *DynamicDB) Fields(ent Entity) (fields []string, types []string, defaul
 		case reflect.Bool:
 			types = append(types, "BOOLEAN")
 			defaults = append(defaults, cmp.Or(field.Tag.Get("default"), "FALSE"))
+		case reflect.Struct:
+			// Zero times are stored so they can be scanned back into time.Time
+			types = append(types, "TIMESTAMP")
+			defaults = append(defaults, cmp.Or(field.Tag.Get("default"), "'0001-01-01 00:00:00+00:00'"))
 		default:
 			types = append(types, "ANY")
 			defaults = append(defaults, cmp.Or(field.Tag.Get("default"), "NULL"))
@@ -146,26 +193,19 @@ func (db *DynamicDB) qualified(ent Entity, fields []string) (res []string) {
 }
 
 func (db *DynamicDB) entID(ent Entity) (id string) {
-	value := reflect.ValueOf(ent)
-	if value.Kind() == reflect.Ptr {
-		value = value.Elem()
-	}
-	if value.Kind() != reflect.Struct {
-		return
-	}
-
-	type_ := value.Type()
-	for i := range type_.NumField() {
-		field := type_.Field(i)
-		if field.Name == "ID" {
-			return value.FieldByName(field.Name).String()
-		}
-	}
+	return ent.GetModel().ID
+}
 
-	return
+// QueryContext prepares a query that is cancelled with the context
+func (db *DynamicDB) QueryContext(ctx context.Context, query string, args ...any) *Iter {
+	return db.Query(query, args...).WithContext(ctx)
 }
 
 func (db *DynamicDB) Insert(ent Entity) error {
+	return db.InsertContext(context.Background(), ent)
+}
+
+func (db *DynamicDB) InsertContext(ctx context.Context, ent Entity) error {
 	fields, values, addrs := db.Reflect(ent)
 
 	places := make([]string, len(fields))
@@ -173,7 +213,7 @@ func (db *DynamicDB) Insert(ent Entity) error {
 		places[i] = "?"
 	}
 
-	return db.Query(fmt.Sprintf(`
+	return db.QueryContext(ctx, fmt.Sprintf(`
 		INSERT INTO %[1]s (%[2]s)
 		VALUES (%[3]s)
 		RETURNING %[2]s
@@ -184,6 +224,10 @@ func (db *DynamicDB) Insert(ent Entity) error {
 }
 
 func (db *DynamicDB) Get(id string, ent Entity) error {
+	return db.GetContext(context.Background(), id, ent)
+}
+
+func (db *DynamicDB) GetContext(ctx context.Context, id string, ent Entity) error {
 	fields, _, addrs := db.Reflect(ent)
 	fields = db.qualified(ent, fields)
 
@@ -192,7 +236,7 @@ func (db *DynamicDB) Get(id string, ent Entity) error {
 		places[i] = "?"
 	}
 
-	return db.Query(fmt.Sprintf(`
+	return db.QueryContext(ctx, fmt.Sprintf(`
 		SELECT %s
 		FROM %s
 		WHERE ID = ?
@@ -201,6 +245,10 @@ func (db *DynamicDB) Get(id string, ent Entity) error {
 }
 
 func (db *DynamicDB) Update(ent Entity) error {
+	return db.UpdateContext(context.Background(), ent)
+}
+
+func (db *DynamicDB) UpdateContext(ctx context.Context, ent Entity) error {
 	var (
 		entityID  any
 		updatedAt any
@@ -220,7 +268,7 @@ func (db *DynamicDB) Update(ent Entity) error {
 	}
 
 	sets[len(fields)] = "UpdatedAt = CURRENT_TIMESTAMP"
-	return db.Query(fmt.Sprintf(`
+	return db.QueryContext(ctx, fmt.Sprintf(`
 		UPDATE %s
 		SET %s
 		WHERE ID = ?
@@ -230,18 +278,28 @@ func (db *DynamicDB) Update(ent Entity) error {
 }
 
 func (db *DynamicDB) Delete(ent Entity) error {
-	return db.Query(fmt.Sprintf(`
-		DELETE %s
+	return db.DeleteContext(context.Background(), ent)
+}
+
+func (db *DynamicDB) DeleteContext(ctx context.Context, ent Entity) error {
+	return db.QueryContext(ctx, fmt.Sprintf(`
+		DELETE FROM %s
 		WHERE ID = ?
 	`, ent.Table()), db.entID(ent)).Exec()
 }
 
 func Cursor[E Entity](db *DynamicDB, ent E, query string, args ...any) *cursor[E] {
+	return CursorContext(context.Background(), db, ent, query, args...)
+}
+
+// CursorContext prepares a cursor whose query is cancelled with the context
+func CursorContext[E Entity](ctx context.Context, db *DynamicDB, ent E, query string, args ...any) *cursor[E] {
 	typeOf := reflect.TypeOf(ent)
-	return &cursor[E]{db, typeOf, ent, query, args}
+	return &cursor[E]{ctx, db, typeOf, ent, query, args}
 }
 
 type cursor[E Entity] struct {
+	ctx    context.Context
 	db     *DynamicDB
 	typeOf reflect.Type
 	entity E
@@ -252,7 +310,7 @@ type cursor[E Entity] struct {
 func (c *cursor[E]) Iter(visit func(func(Entity) error) error) error {
 	fields, _, _ := c.db.Reflect(c.entity)
 	fields = c.db.qualified(c.entity, fields)
-	err := c.db.Query(
+	err := c.db.QueryContext(c.ctx,
 		fmt.Sprintf(`SELECT %s FROM %s %s`,
 			strings.Join(fields, ", "), c.entity.Table(), c.query,
 		), c.args...).
@@ -270,9 +328,9 @@ func (c *cursor[E]) Iter(visit func(func(Entity) error) error) error {
 
 func (c *cursor[E]) One() (E, error) {
 	ent := reflect.New(c.typeOf.Elem()).Interface().(E)
-	ent.GetModel().SetDB(c.db)
+	c.db.bind(ent)
 	fields, _, attrs := c.db.Reflect(ent)
-	return ent, c.db.Query(
+	return ent, c.db.QueryContext(c.ctx,
 		fmt.Sprintf(`SELECT %s FROM %s %s`,
 			strings.Join(fields, ", "), ent.Table(), c.query,
 		), c.args...).
@@ -32,7 +32,7 @@ func Open(name string, tables fs.FS) *SQLite3 {
 	}
 
 	dbFilePath := filepath.Join(db.root, name)
-	if db.DB, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL", dbFilePath)); err != nil {
+	if db.DB, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000&_txlock=immediate", dbFilePath)); err != nil {
 		log.Fatalf("Failed to connect to datatabase: %v", err)
 	}
 
@@ -76,6 +76,14 @@ func (db *SQLite3) Query(query string, args ...any) *database.Iter {
 	return &database.Iter{Conn: db.DB, Text: query, Args: args}
 }
 
-func (db *SQLite3) Dynamic() *database.DynamicDB {
-	return database.Dynamic(db)
+// Close checkpoints the write-ahead log and closes the connection
+func (db *SQLite3) Close() error {
+	if _, err := db.DB.Exec("PRAGMA wal_checkpoint(TRUNCATE);"); err != nil {
+		log.Printf("Failed to checkpoint WAL: %v", err)
+	}
+	return db.DB.Close()
+}
+
+func (db *SQLite3) Dynamic(opts ...database.DynamicDBOption) *database.DynamicDB {
+	return database.Dynamic(db, opts...)
 }
@@ -1,30 +1,69 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync/atomic"
 )
 
 var (
 	ErrIterStop = fmt.Errorf("stop iteration")
 )
 
+// queries counts the statements run by every Iter
+var queries atomic.Uint64
+
+// Queries returns the number of statements run since the process started
+func Queries() uint64 {
+	return queries.Load()
+}
+
+// Conn runs statements on a database or in a transaction,
+// like *sql.DB and *sql.Tx
+type Conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Iter struct {
-	Conn *sql.DB
+	Conn Conn
 	Text string
 	Args []any
+
+	// ctx cancels the query, set by QueryContext
+	ctx context.Context
+}
+
+// Context returns the iter's context, or the background context
+// for queries made without one
+func (i *Iter) Context() context.Context {
+	if i.ctx == nil {
+		return context.Background()
+	}
+	return i.ctx
 }
 
 type reader func(ScanFunc) error
 type ScanFunc func(...any) error
 
+// WithContext returns a copy of the iter that runs with the context
+func (i *Iter) WithContext(ctx context.Context) *Iter {
+	iter := *i
+	iter.ctx = ctx
+	return &iter
+}
+
 func (i *Iter) Exec() error {
-	_, err := i.Conn.Exec(i.Text, i.Args...)
+	queries.Add(1)
+	_, err := i.Conn.ExecContext(i.Context(), i.Text, i.Args...)
 	return err
 }
 
 func (i *Iter) Scan(args ...any) error {
-	row := i.Conn.QueryRow(i.Text, i.Args...)
+	queries.Add(1)
+	row := i.Conn.QueryRowContext(i.Context(), i.Text, i.Args...)
 	if err := row.Err(); err != nil {
 		return err
 	}
@@ -33,7 +72,8 @@ func (i *Iter) Scan(args ...any) error {
 }
 
 func (i *Iter) All(fn reader) error {
-	rows, err := i.Conn.Query(i.Text, i.Args...)
+	queries.Add(1)
+	rows, err := i.Conn.QueryContext(i.Context(), i.Text, i.Args...)
 	if err != nil {
 		return err
 	}
@@ -49,7 +89,8 @@ func (i *Iter) All(fn reader) error {
 }
 
 func (i *Iter) Page(limit int, fn reader) (more bool, err error) {
-	rows, err := i.Conn.Query(i.Text, i.Args...)
+	queries.Add(1)
+	rows, err := i.Conn.QueryContext(i.Context(), i.Text, i.Args...)
 	if err != nil {
 		return false, err
 	}
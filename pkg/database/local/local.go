@@ -9,6 +9,6 @@ import (
 // in the future we may add more options to configure
 // what engine we want to be using and what modules
 // we want to load.
-func Database(name string) *database.DynamicDB {
-	return sqlite3.Open(name, nil).Dynamic()
+func Database(name string, opts ...database.DynamicDBOption) *database.DynamicDB {
+	return sqlite3.Open(name, nil).Dynamic(opts...)
 }
@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Order is the direction rows are sorted in by OrderBy
+type Order string
+
+const (
+	Asc  Order = "ASC"
+	Desc Order = "DESC"
+)
+
+// operators are the comparisons a Where column can end with
+var operators = []string{"=", "!=", "<>", "<", "<=", ">", ">=", "NOT LIKE", "LIKE"}
+
+// Query is a filter on a collection built one clause at a time, with
+// columns checked against the entity's fields and values sent as
+// parameters. Errors are reported when the query runs. Each clause
+// returns a new query, so a base query can be shared and built on.
+//
+//	todos, err := Todos.Where("UserID", user.ID).
+//		Where("Completed", false).
+//		OrderBy("CreatedAt", Desc).
+//		Limit(20).
+//		All()
+type Query[E Entity] struct {
+	coll   *Collection[E]
+	wheres []string
+	args   []any
+	orders []string
+	limit  int
+	offset int
+	err    error
+
+	// relations loaded into the entities found
+	preloads []relation
+}
+
+// Where starts a query for the entities matching the condition
+func (c *Collection[E]) Where(column string, value any) *Query[E] {
+	return (&Query[E]{coll: c}).Where(column, value)
+}
+
+// OrderBy starts a query for every entity, sorted by the column
+func (c *Collection[E]) OrderBy(column string, order Order) *Query[E] {
+	return (&Query[E]{coll: c}).OrderBy(column, order)
+}
+
+// Where keeps the rows whose column matches the value. The column can
+// end with an operator, like "DueDate <", and is compared with = by
+// default. Slices match any of their values and nil matches NULL.
+func (q *Query[E]) Where(column string, value any) *Query[E] {
+	q = q.clone()
+	column, op := strings.TrimSpace(column), "="
+	for _, o := range operators {
+		if rest, ok := strings.CutSuffix(column, " "+o); ok {
+			column, op = strings.TrimSpace(rest), o
+			break
+		}
+	}
+
+	if !q.valid(column) {
+		return q
+	}
+
+	switch v := reflect.ValueOf(value); {
+	case value == nil:
+		if op == "=" {
+			q.wheres = append(q.wheres, column+" IS NULL")
+		} else {
+			q.wheres = append(q.wheres, column+" IS NOT NULL")
+		}
+
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		if op != "=" && op != "!=" && op != "<>" {
+			q.fail(errors.Errorf("cannot compare %s with %s to a list", column, op))
+			return q
+		}
+		if v.Len() == 0 {
+			// Nothing is in an empty list
+			if op == "=" {
+				q.wheres = append(q.wheres, "1 = 0")
+			}
+			return q
+		}
+
+		places := make([]string, v.Len())
+		for i := range v.Len() {
+			places[i] = "?"
+			q.args = append(q.args, v.Index(i).Interface())
+		}
+		in := "IN"
+		if op != "=" {
+			in = "NOT IN"
+		}
+		q.wheres = append(q.wheres, fmt.Sprintf("%s %s (%s)", column, in, strings.Join(places, ", ")))
+
+	default:
+		q.wheres = append(q.wheres, column+" "+op+" ?")
+		q.args = append(q.args, value)
+	}
+
+	return q
+}
+
+// OrderBy sorts the rows by the column, after any earlier orders
+func (q *Query[E]) OrderBy(column string, order Order) *Query[E] {
+	q = q.clone()
+	if order != Asc && order != Desc {
+		q.fail(errors.Errorf("invalid order %q", order))
+		return q
+	}
+	if q.valid(column) {
+		q.orders = append(q.orders, column+" "+string(order))
+	}
+	return q
+}
+
+// Limit returns at most n rows
+func (q *Query[E]) Limit(n int) *Query[E] {
+	q = q.clone()
+	q.limit = n
+	return q
+}
+
+// Offset skips the first n rows
+func (q *Query[E]) Offset(n int) *Query[E] {
+	q = q.clone()
+	q.offset = n
+	return q
+}
+
+// All returns every matching entity
+func (q *Query[E]) All() ([]E, error) {
+	return q.AllContext(context.Background())
+}
+
+func (q *Query[E]) AllContext(ctx context.Context) ([]E, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	ents, err := q.coll.SearchContext(ctx, q.clause(), q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return ents, q.preload(ctx, ents)
+}
+
+// First returns the first matching entity, or sql.ErrNoRows
+func (q *Query[E]) First() (E, error) {
+	return q.FirstContext(context.Background())
+}
+
+func (q *Query[E]) FirstContext(ctx context.Context) (E, error) {
+	ents, err := q.Limit(1).AllContext(ctx)
+	if err != nil {
+		var zero E
+		return zero, err
+	}
+	if len(ents) == 0 {
+		var zero E
+		return zero, sql.ErrNoRows
+	}
+	return ents[0], nil
+}
+
+// Count returns the number of matching rows, ignoring the limit
+func (q *Query[E]) Count() (int, error) {
+	return q.CountContext(context.Background())
+}
+
+func (q *Query[E]) CountContext(ctx context.Context) (count int, err error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	return count, q.coll.DB.QueryContext(ctx,
+		fmt.Sprintf(`SELECT count(*) FROM %s %s`, q.coll.Ent.Table(), q.where()),
+		q.args...).Scan(&count)
+}
+
+// Exists reports whether any row matches
+func (q *Query[E]) Exists() (bool, error) {
+	return q.ExistsContext(context.Background())
+}
+
+func (q *Query[E]) ExistsContext(ctx context.Context) (exists bool, err error) {
+	if q.err != nil {
+		return false, q.err
+	}
+	return exists, q.coll.DB.QueryContext(ctx,
+		fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s %s)`, q.coll.Ent.Table(), q.where()),
+		q.args...).Scan(&exists)
+}
+
+// Delete removes the matching rows, or only those within the limit
+// and offset when they are set
+func (q *Query[E]) Delete() error {
+	return q.DeleteContext(context.Background())
+}
+
+func (q *Query[E]) DeleteContext(ctx context.Context) error {
+	if q.err != nil {
+		return q.err
+	}
+
+	table := q.coll.Ent.Table()
+	if q.limit > 0 || q.offset > 0 {
+		return q.coll.DB.QueryContext(ctx,
+			fmt.Sprintf(`DELETE FROM %[1]s WHERE ID IN (SELECT ID FROM %[1]s %[2]s)`, table, q.clause()),
+			q.args...).Exec()
+	}
+
+	return q.coll.DB.QueryContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s %s`, table, q.where()),
+		q.args...).Exec()
+}
+
+// clause returns the SQL following the table name
+func (q *Query[E]) clause() string {
+	var b strings.Builder
+	b.WriteString(q.where())
+	if len(q.orders) > 0 {
+		b.WriteString(" ORDER BY " + strings.Join(q.orders, ", "))
+	}
+	if q.limit > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", q.limit)
+	} else if q.offset > 0 {
+		// SQLite needs a limit before an offset, -1 is none
+		b.WriteString(" LIMIT -1")
+	}
+	if q.offset > 0 {
+		fmt.Fprintf(&b, " OFFSET %d", q.offset)
+	}
+	return b.String()
+}
+
+func (q *Query[E]) where() string {
+	if len(q.wheres) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(q.wheres, " AND ")
+}
+
+// valid checks the column is one of the entity's, keeping the
+// first error for when the query runs
+func (q *Query[E]) valid(column string) bool {
+	fields, _, _ := q.coll.DB.Fields(q.coll.Ent)
+	if column == "ID" || column == "CreatedAt" || column == "UpdatedAt" || slices.Contains(fields, column) {
+		return true
+	}
+	q.fail(errors.Errorf("%s has no column %q", q.coll.Ent.Table(), column))
+	return false
+}
+
+// clone copies the query so adding a clause leaves the original as it was
+func (q *Query[E]) clone() *Query[E] {
+	c := *q
+	c.wheres = slices.Clone(q.wheres)
+	c.args = slices.Clone(q.args)
+	c.orders = slices.Clone(q.orders)
+	c.preloads = slices.Clone(q.preloads)
+	return &c
+}
+
+func (q *Query[E]) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
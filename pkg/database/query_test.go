@@ -0,0 +1,33 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/The-Skyscape/devtools/pkg/database"
+	"github.com/The-Skyscape/devtools/pkg/database/local"
+)
+
+func TestQueryClausesLeaveBaseQuery(t *testing.T) {
+	t.Setenv("INTERNAL_DATA", t.TempDir())
+
+	db := local.Database("test.db")
+	t.Cleanup(func() { db.Close() })
+
+	counts := database.Manage(db, new(countInt))
+	for _, count := range []int{1, 2, 3} {
+		if _, err := counts.Insert(&countInt{Model: db.NewModel(""), Count: count}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := counts.Where("Count >", 1)
+	if n, err := base.Where("Count", 3).Count(); err != nil || n != 1 {
+		t.Fatalf("narrowed query counted %d, %v", n, err)
+	}
+	if _, err := base.First(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := base.Count(); err != nil || n != 2 {
+		t.Errorf("base query counted %d, %v after being built on, want 2", n, err)
+	}
+}
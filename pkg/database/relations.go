@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+var entityType = reflect.TypeOf((*Entity)(nil)).Elem()
+
+// relation is a field holding entities related by a foreign key,
+// declared with a belongs_to or has_many tag naming the key's column
+//
+//	type Session struct {
+//		database.Model
+//		UserID string
+//		User   *User `belongs_to:"UserID"`
+//	}
+//
+//	type User struct {
+//		database.Model
+//		Sessions []*Session `has_many:"UserID"`
+//	}
+type relation struct {
+	field  reflect.StructField
+	kind   string // belongs_to or has_many
+	column string // the foreign key, in this entity or the related one
+	target Entity // a new related entity
+}
+
+// relations returns the relations declared by the entity's fields
+func relations(ent Entity) (rels []relation, err error) {
+	type_ := reflect.TypeOf(ent)
+	if type_.Kind() == reflect.Ptr {
+		type_ = type_.Elem()
+	}
+	if type_.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	for i := range type_.NumField() {
+		field := type_.Field(i)
+		if column, ok := field.Tag.Lookup("belongs_to"); ok {
+			if field.Type.Kind() != reflect.Ptr || !field.Type.Implements(entityType) {
+				return nil, errors.Errorf("%s.%s belongs to an entity, so it must be a pointer to one", type_.Name(), field.Name)
+			}
+			if !hasColumn(ent, column) {
+				return nil, errors.Errorf("%s.%s belongs to %s by %s, which is not a column", type_.Name(), field.Name, field.Type.Elem().Name(), column)
+			}
+			rels = append(rels, relation{field, "belongs_to", column, newEntity(field.Type)})
+		}
+
+		if column, ok := field.Tag.Lookup("has_many"); ok {
+			if field.Type.Kind() != reflect.Slice || field.Type.Elem().Kind() != reflect.Ptr || !field.Type.Elem().Implements(entityType) {
+				return nil, errors.Errorf("%s.%s has many entities, so it must be a slice of pointers to them", type_.Name(), field.Name)
+			}
+			target := newEntity(field.Type.Elem())
+			if !hasColumn(target, column) {
+				return nil, errors.Errorf("%s.%s has many %s by %s, which is not a column of %[3]s", type_.Name(), field.Name, field.Type.Elem().Elem().Name(), column)
+			}
+			rels = append(rels, relation{field, "has_many", column, target})
+		}
+	}
+
+	return rels, nil
+}
+
+func newEntity(type_ reflect.Type) Entity {
+	return reflect.New(type_.Elem()).Interface().(Entity)
+}
+
+func hasColumn(ent Entity, column string) bool {
+	return slices.ContainsFunc(Columns(ent), func(field reflect.StructField) bool {
+		return field.Name == column
+	})
+}
+
+// index creates an index on each foreign key of the relations
+func (db *DynamicDB) index(ent Entity, rels []relation) error {
+	for _, rel := range rels {
+		table := ent.Table()
+		if rel.kind == "has_many" {
+			// The related entity holds the key, so it
+			// needs its table before it can be indexed
+			if err := db.Register(rel.target); err != nil {
+				return err
+			}
+			table = rel.target.Table()
+		}
+
+		if err := db.Query(fmt.Sprintf(`
+			CREATE INDEX IF NOT EXISTS %[1]s_%[2]s ON %[1]s (%[2]s)
+		`, table, rel.column)).Exec(); err != nil {
+			return errors.Wrapf(err, "failed to index %s.%s", table, rel.column)
+		}
+	}
+	return nil
+}
+
+// Preload starts a query for every entity, loading the related
+// entities in the named fields
+func (c *Collection[E]) Preload(fields ...string) *Query[E] {
+	return (&Query[E]{coll: c}).Preload(fields...)
+}
+
+// Preload fills the named relation fields of the entities found, with
+// one query for each relation rather than one for each entity
+//
+//	sessions, err := Sessions.Where("UserID", id).Preload("User").All()
+func (q *Query[E]) Preload(fields ...string) *Query[E] {
+	q = q.clone()
+	rels, err := relations(q.coll.Ent)
+	if err != nil {
+		q.fail(err)
+		return q
+	}
+
+	for _, name := range fields {
+		i := slices.IndexFunc(rels, func(rel relation) bool { return rel.field.Name == name })
+		if i < 0 {
+			q.fail(errors.Errorf("%s has no relation %q", q.coll.Ent.Table(), name))
+			continue
+		}
+		q.preloads = append(q.preloads, rels[i])
+	}
+	return q
+}
+
+// preload loads each of the query's relations into the entities
+func (q *Query[E]) preload(ctx context.Context, ents []E) error {
+	if len(ents) == 0 {
+		return nil
+	}
+
+	for _, rel := range q.preloads {
+		related := &Collection[Entity]{q.coll.DB, rel.target, reflect.TypeOf(rel.target)}
+		switch rel.kind {
+		case "belongs_to":
+			ids, seen := []any{}, map[any]bool{}
+			for _, ent := range ents {
+				if id := fieldOf(ent, rel.column).Interface(); !seen[id] && id != "" {
+					ids, seen[id] = append(ids, id), true
+				}
+			}
+			if len(ids) == 0 {
+				continue
+			}
+
+			found, err := related.Where("ID", ids).AllContext(ctx)
+			if err != nil {
+				return errors.Wrapf(err, "failed to preload %s", rel.field.Name)
+			}
+			byID := map[string]Entity{}
+			for _, r := range found {
+				byID[r.GetModel().ID] = r
+			}
+
+			for _, ent := range ents {
+				id := fieldOf(ent, rel.column)
+				if r, ok := byID[fmt.Sprint(id.Interface())]; ok {
+					fieldOf(ent, rel.field.Name).Set(reflect.ValueOf(r))
+				}
+			}
+
+		case "has_many":
+			ids := make([]string, len(ents))
+			for i, ent := range ents {
+				ids[i] = ent.GetModel().ID
+			}
+
+			found, err := related.Where(rel.column, ids).OrderBy("CreatedAt", Asc).AllContext(ctx)
+			if err != nil {
+				return errors.Wrapf(err, "failed to preload %s", rel.field.Name)
+			}
+			byParent := map[string][]Entity{}
+			for _, r := range found {
+				parent := fmt.Sprint(fieldOf(r, rel.column).Interface())
+				byParent[parent] = append(byParent[parent], r)
+			}
+
+			for _, ent := range ents {
+				children := reflect.MakeSlice(rel.field.Type, 0, len(byParent[ent.GetModel().ID]))
+				for _, r := range byParent[ent.GetModel().ID] {
+					children = reflect.Append(children, reflect.ValueOf(r))
+				}
+				fieldOf(ent, rel.field.Name).Set(children)
+			}
+		}
+	}
+
+	return nil
+}
+
+func fieldOf(ent Entity, name string) reflect.Value {
+	return reflect.ValueOf(ent).Elem().FieldByName(name)
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+	"log"
 	"reflect"
 	"time"
 
@@ -14,50 +16,81 @@ type Collection[E Entity] struct {
 }
 
 func Manage[E Entity](db *DynamicDB, ent E) *Collection[E] {
-	db.Register(ent)
+	if err := db.Register(ent); err != nil {
+		log.Fatalf("failed to register %s: %v", ent.Table(), err)
+	}
 	t := reflect.TypeOf(ent)
 	db.Repos[ent.Table()] = &Collection[Entity]{db, ent, t}
 	return &Collection[E]{db, ent, t}
 }
 
+// In returns the collection running in the transaction
+func (c *Collection[E]) In(tx *DynamicDB) *Collection[E] {
+	return &Collection[E]{tx, c.Ent, c.Type}
+}
+
 func (c *Collection[E]) Count() (count int) {
-	c.DB.Query(`select count(*) from ` + c.Ent.Table()).
+	return c.CountContext(context.Background())
+}
+
+func (c *Collection[E]) CountContext(ctx context.Context) (count int) {
+	c.DB.QueryContext(ctx, `select count(*) from `+c.Ent.Table()).
 		Scan(&count)
 	return count
 }
 
 func (c *Collection[E]) New() E {
 	ent := reflect.New(c.Type.Elem()).Interface().(E)
-	ent.GetModel().SetDB(c.DB)
+	c.DB.bind(ent)
 	return ent
 }
 
 func (c *Collection[E]) Get(id string) (E, error) {
+	return c.GetContext(context.Background(), id)
+}
+
+func (c *Collection[E]) GetContext(ctx context.Context, id string) (E, error) {
 	ent := c.New()
-	return ent, c.DB.Get(id, ent)
+	return ent, c.DB.GetContext(ctx, id, ent)
 }
 
 func (c *Collection[E]) Insert(ent E) (E, error) {
-	ent.GetModel().SetDB(c.DB)
+	return c.InsertContext(context.Background(), ent)
+}
+
+func (c *Collection[E]) InsertContext(ctx context.Context, ent E) (E, error) {
+	c.DB.bind(ent)
 	if ent.GetModel().ID == "" {
 		ent.GetModel().ID = uuid.NewString()
 		ent.GetModel().CreatedAt = time.Now()
 		ent.GetModel().UpdatedAt = time.Now()
 	}
-	return ent, c.DB.Insert(ent)
+	return ent, c.DB.InsertContext(ctx, ent)
 }
 
 func (c *Collection[E]) Update(ent E) error {
-	return c.DB.Update(ent)
+	return c.UpdateContext(context.Background(), ent)
+}
+
+func (c *Collection[E]) UpdateContext(ctx context.Context, ent E) error {
+	return c.DB.UpdateContext(ctx, ent)
 }
 
 func (c *Collection[E]) Delete(ent E) error {
-	return c.DB.Delete(ent)
+	return c.DeleteContext(context.Background(), ent)
+}
+
+func (c *Collection[E]) DeleteContext(ctx context.Context, ent E) error {
+	return c.DB.DeleteContext(ctx, ent)
 }
 
 func (c *Collection[E]) Search(query string, args ...any) ([]E, error) {
+	return c.SearchContext(context.Background(), query, args...)
+}
+
+func (c *Collection[E]) SearchContext(ctx context.Context, query string, args ...any) ([]E, error) {
 	apps := []E{}
-	return apps, Cursor(c.DB, c.Ent, query, args...).
+	return apps, CursorContext(ctx, c.DB, c.Ent, query, args...).
 		Iter(func(load func(Entity) error) error {
 			app := c.New()
 			if err := load(app); err != nil {
@@ -69,8 +102,12 @@ func (c *Collection[E]) Search(query string, args ...any) ([]E, error) {
 }
 
 func (c *Collection[E]) Find(query string, args ...any) (E, error) {
+	return c.FindContext(context.Background(), query, args...)
+}
+
+func (c *Collection[E]) FindContext(ctx context.Context, query string, args ...any) (E, error) {
 	app := c.New()
-	return app, Cursor(c.DB, c.Ent, query, args...).
+	return app, CursorContext(ctx, c.DB, c.Ent, query, args...).
 		Iter(func(load func(Entity) error) error {
 			if err := load(app); err != nil {
 				return err
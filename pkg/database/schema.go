@@ -0,0 +1,474 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChangeKind is what a change does to the schema
+type ChangeKind string
+
+const (
+	CreateTable  ChangeKind = "create table"
+	AddColumn    ChangeKind = "add column"
+	ChangeType   ChangeKind = "change type"
+	DropColumn   ChangeKind = "drop column"
+	AddReference ChangeKind = "add reference"
+)
+
+// Change is a difference between a table and its entity
+type Change struct {
+	Kind   ChangeKind
+	Table  string
+	Column string
+	From   string // the column's type in the table
+	To     string // the column's type in the entity, or the table it references
+
+	ent Entity
+}
+
+// Rebuild reports whether the table must be rebuilt to make the change,
+// which SQLite cannot do in place
+func (c Change) Rebuild() bool {
+	return c.Kind == ChangeType || c.Kind == DropColumn || c.Kind == AddReference
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case CreateTable:
+		return fmt.Sprintf("create table %s", c.Table)
+	case AddColumn:
+		return fmt.Sprintf("%s: add column %s %s", c.Table, c.Column, c.To)
+	case ChangeType:
+		return fmt.Sprintf("%s: change %s from %s to %s (rebuild)", c.Table, c.Column, c.From, c.To)
+	case AddReference:
+		return fmt.Sprintf("%s: reference %s from %s (rebuild)", c.Table, c.To, c.Column)
+	default:
+		return fmt.Sprintf("%s: drop column %s %s (rebuild)", c.Table, c.Column, c.From)
+	}
+}
+
+// Plan is the changes that make the tables match their entities
+type Plan []Change
+
+// Rebuilds reports whether any change needs a table rebuilt
+func (p Plan) Rebuilds() bool {
+	for _, change := range p {
+		if change.Rebuild() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Plan) String() string {
+	if len(p) == 0 {
+		return "schema is up to date"
+	}
+
+	lines := make([]string, len(p))
+	for i, change := range p {
+		lines[i] = "  " + change.String()
+	}
+	return "schema changes:\n" + strings.Join(lines, "\n")
+}
+
+// WithRebuilds lets Register rebuild tables to change the type of columns,
+// drop those no longer in the entity or declare their foreign keys,
+// copying the rows across. Without it those changes are reported once and
+// left for the tables to be migrated by hand. It must come before any
+// WithModel.
+func WithRebuilds() DynamicDBOption {
+	return func(db *DynamicDB) {
+		db.rebuilds = true
+	}
+}
+
+// WithDryRun makes Register report the changes it would make to the
+// schema without making them
+func WithDryRun() DynamicDBOption {
+	return func(db *DynamicDB) {
+		db.dryRun = true
+	}
+}
+
+// storage lists the storage classes each column type can be scanned
+// back from, which the values copied by a rebuild are checked against
+var storage = map[string][]string{
+	"TEXT":      {"text"},
+	"INTEGER":   {"integer"},
+	"REAL":      {"real", "integer"},
+	"BOOLEAN":   {"integer"},
+	"TIMESTAMP": {"text", "integer", "real"},
+}
+
+// column is the definition of a column an entity is stored in
+type column struct {
+	name, type_, def string
+}
+
+// columns returns the definitions of the entity's columns
+func (db *DynamicDB) columns(ent Entity, rels []relation) []column {
+	cols := []column{
+		{"ID", "TEXT", "ID TEXT PRIMARY KEY"},
+		{"CreatedAt", "TIMESTAMP", "CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+		{"UpdatedAt", "TIMESTAMP", "UpdatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+	}
+
+	refs := map[string]string{}
+	for _, rel := range rels {
+		if rel.kind == "belongs_to" {
+			refs[rel.column] = fmt.Sprintf(" REFERENCES %s (ID)", rel.target.Table())
+		}
+	}
+
+	fields, types, defaults := db.Fields(ent)
+	for i, field := range fields {
+		def := fmt.Sprintf("%s %s DEFAULT %v%s", field, types[i], defaults[i], refs[field])
+		cols = append(cols, column{field, types[i], def})
+	}
+
+	return cols
+}
+
+// tableInfo returns the type of each of the table's columns by
+// name, or nil when there is no table
+func (db *DynamicDB) tableInfo(table string) (map[string]string, []string, error) {
+	var (
+		types = map[string]string{}
+		names []string
+	)
+
+	err := db.Query(`SELECT name, type FROM pragma_table_info(?)`, table).
+		All(func(scan ScanFunc) error {
+			var name, type_ string
+			if err := scan(&name, &type_); err != nil {
+				return err
+			}
+			types[strings.ToLower(name)] = type_
+			names = append(names, name)
+			return nil
+		})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to inspect %s", table)
+	}
+
+	if len(names) == 0 {
+		return nil, nil, nil
+	}
+	return types, names, nil
+}
+
+// foreignKeys returns the table referenced by each of the table's
+// foreign keys, by the lowercase name of its column
+func (db *DynamicDB) foreignKeys(table string) (map[string]string, error) {
+	refs := map[string]string{}
+	err := db.Query(`SELECT "from", "table" FROM pragma_foreign_key_list(?)`, table).
+		All(func(scan ScanFunc) error {
+			var from, target string
+			if err := scan(&from, &target); err != nil {
+				return err
+			}
+			refs[strings.ToLower(from)] = target
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to inspect foreign keys of %s", table)
+	}
+	return refs, nil
+}
+
+// Plan compares the tables of the entities, or every registered
+// entity, with their fields and returns the changes needed
+//
+//	plan, err := db.Plan()
+//	log.Println(plan)
+func (db *DynamicDB) Plan(ents ...Entity) (Plan, error) {
+	if len(ents) == 0 {
+		ents = db.Ents
+	}
+
+	var plan Plan
+	for _, ent := range ents {
+		changes, err := db.plan(ent)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, changes...)
+	}
+	return plan, nil
+}
+
+func (db *DynamicDB) plan(ent Entity) (plan Plan, err error) {
+	rels, err := relations(ent)
+	if err != nil {
+		return nil, err
+	}
+
+	table := ent.Table()
+	existing, names, err := db.tableInfo(table)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return Plan{{Kind: CreateTable, Table: table, ent: ent}}, nil
+	}
+
+	wanted := map[string]bool{}
+	for _, col := range db.columns(ent, rels) {
+		wanted[strings.ToLower(col.name)] = true
+
+		type_, ok := existing[strings.ToLower(col.name)]
+		if !ok {
+			plan = append(plan, Change{Kind: AddColumn, Table: table, Column: col.name, To: col.type_, ent: ent})
+		} else if !strings.EqualFold(type_, col.type_) {
+			plan = append(plan, Change{Kind: ChangeType, Table: table, Column: col.name, From: type_, To: col.type_, ent: ent})
+		}
+	}
+
+	for _, name := range names {
+		if !wanted[strings.ToLower(name)] {
+			plan = append(plan, Change{Kind: DropColumn, Table: table, Column: name, From: existing[strings.ToLower(name)], ent: ent})
+		}
+	}
+
+	// Keys added as columns get their reference with them, those
+	// already in the table need it rebuilt to declare one
+	refs, err := db.foreignKeys(table)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range rels {
+		if _, ok := existing[strings.ToLower(rel.column)]; !ok || rel.kind != "belongs_to" {
+			continue
+		}
+		if target := rel.target.Table(); !strings.EqualFold(refs[strings.ToLower(rel.column)], target) {
+			plan = append(plan, Change{Kind: AddReference, Table: table, Column: rel.column, To: target, ent: ent})
+		}
+	}
+
+	return plan, nil
+}
+
+// migrate makes the changes of the plan, rebuilding tables only when
+// they are allowed and reporting the changes left undone
+func (db *DynamicDB) migrate(plan Plan) error {
+	if len(plan) == 0 {
+		return nil
+	}
+
+	if db.dryRun {
+		log.Println("Dry run of", plan)
+		return nil
+	}
+
+	rebuild := map[string]Entity{}
+	var skipped Plan
+	for _, change := range plan {
+		switch {
+		case change.Kind == CreateTable:
+			if err := db.createTable(change.Table, change.ent); err != nil {
+				return err
+			}
+
+		case change.Kind == AddColumn:
+			if err := db.addColumn(change); err != nil {
+				return err
+			}
+
+		case db.rebuilds:
+			rebuild[change.Table] = change.ent
+
+		default:
+			skipped = append(skipped, change)
+		}
+	}
+
+	for table, ent := range rebuild {
+		if err := db.rebuild(table, ent); err != nil {
+			return err
+		}
+	}
+
+	if skipped = db.unreported(skipped); len(skipped) > 0 {
+		log.Printf("Skipped %s\nUse database.WithRebuilds() to apply them", skipped)
+	}
+	return nil
+}
+
+// unreported records the skipped changes in the schema state and returns
+// those not recorded before, so each is reported once instead of on
+// every start
+func (db *DynamicDB) unreported(skipped Plan) (fresh Plan) {
+	if len(skipped) == 0 {
+		return nil
+	}
+
+	if err := db.Query(`
+		CREATE TABLE IF NOT EXISTS _skipped_changes (
+			Change TEXT PRIMARY KEY
+		)
+	`).Exec(); err != nil {
+		return skipped
+	}
+
+	for _, change := range skipped {
+		var recorded string
+		err := db.Query(`
+			INSERT OR IGNORE INTO _skipped_changes (Change)
+			VALUES (?)
+			RETURNING Change
+		`, change.String()).Scan(&recorded)
+		if !errors.Is(err, sql.ErrNoRows) {
+			fresh = append(fresh, change)
+		}
+	}
+	return fresh
+}
+
+func (db *DynamicDB) createTable(table string, ent Entity) error {
+	rels, err := relations(ent)
+	if err != nil {
+		return err
+	}
+
+	defs := []string{}
+	for _, col := range db.columns(ent, rels) {
+		defs = append(defs, col.def)
+	}
+
+	if err := db.Query(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			%s
+		)
+	`, table, strings.Join(defs, ",\n\t\t\t"))).Exec(); err != nil {
+		return errors.Wrapf(err, "failed to create table %s", table)
+	}
+	return nil
+}
+
+func (db *DynamicDB) addColumn(change Change) error {
+	rels, err := relations(change.ent)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range db.columns(change.ent, rels) {
+		if col.name != change.Column {
+			continue
+		}
+		if err := db.Query(fmt.Sprintf(`
+			ALTER TABLE %s ADD COLUMN %s
+		`, change.Table, col.def)).Exec(); err != nil {
+			return errors.Wrapf(err, "failed to add column %s.%s", change.Table, change.Column)
+		}
+	}
+	return nil
+}
+
+// rebuild recreates the table with the entity's columns, copying the
+// rows of the columns it keeps and the indexes that still apply, all
+// in one transaction. SQLite converts the copied values to the type of
+// their new column when it can and keeps them as they are otherwise,
+// so the rebuild is undone when any value is left unconverted.
+func (db *DynamicDB) rebuild(table string, ent Entity) error {
+	existing, _, err := db.tableInfo(table)
+	if err != nil {
+		return err
+	}
+
+	rels, err := relations(ent)
+	if err != nil {
+		return err
+	}
+
+	var (
+		kept    []string
+		changed []column
+	)
+	for _, col := range db.columns(ent, rels) {
+		type_, ok := existing[strings.ToLower(col.name)]
+		if !ok {
+			continue
+		}
+		kept = append(kept, col.name)
+		if !strings.EqualFold(type_, col.type_) {
+			changed = append(changed, col)
+		}
+	}
+
+	var indexes []string
+	err = db.Query(`
+		SELECT sql FROM sqlite_master
+		WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL
+	`, table).All(func(scan ScanFunc) error {
+		var index string
+		if err := scan(&index); err != nil {
+			return err
+		}
+		indexes = append(indexes, index)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to read indexes of %s", table)
+	}
+
+	log.Printf("Rebuilding table %s", table)
+	ctx := context.Background()
+	return db.Tx(ctx, func(tx *DynamicDB) error {
+		temp := table + "_rebuild"
+		if err := tx.createTable(temp, ent); err != nil {
+			return err
+		}
+
+		columns := strings.Join(kept, ", ")
+		if err := tx.Query(fmt.Sprintf(`
+			INSERT INTO %s (%s) SELECT %s FROM %s
+		`, temp, columns, columns, table)).Exec(); err != nil {
+			return errors.Wrapf(err, "failed to copy rows of %s", table)
+		}
+
+		for _, col := range changed {
+			classes, ok := storage[col.type_]
+			if !ok {
+				continue
+			}
+
+			var count int
+			if err := tx.Query(fmt.Sprintf(`
+				SELECT count(*) FROM %s
+				WHERE %s IS NOT NULL AND typeof(%[2]s) NOT IN ('%s')
+			`, temp, col.name, strings.Join(classes, "', '"))).Scan(&count); err != nil {
+				return errors.Wrapf(err, "failed to check %s.%s", table, col.name)
+			}
+			if count > 0 {
+				return errors.Errorf("cannot change %s.%s to %s, %d rows hold values that do not convert", table, col.name, col.type_, count)
+			}
+		}
+
+		if err := tx.Query(`DROP TABLE ` + table).Exec(); err != nil {
+			return errors.Wrapf(err, "failed to drop %s", table)
+		}
+
+		if err := tx.Query(fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, temp, table)).Exec(); err != nil {
+			return errors.Wrapf(err, "failed to rename %s", temp)
+		}
+
+		// Indexes on dropped columns go with them
+		for _, index := range indexes {
+			if err := tx.Tx(ctx, func(tx *DynamicDB) error {
+				return tx.Query(index).Exec()
+			}); err != nil {
+				log.Printf("Dropped index of %s: %v", table, err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,126 @@
+package database_test
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/The-Skyscape/devtools/pkg/database"
+	"github.com/The-Skyscape/devtools/pkg/database/local"
+)
+
+// countText stores Count as text, as an entity did before the field
+// became a number
+type countText struct {
+	database.Model
+	Count string
+}
+
+func (*countText) Table() string { return "counts" }
+
+type countInt struct {
+	database.Model
+	Count int
+}
+
+func (*countInt) Table() string { return "counts" }
+
+// open registers the old entity with rows holding the counts, and
+// opens the database again allowing rebuilds
+func open(t *testing.T, counts ...string) *database.DynamicDB {
+	t.Setenv("INTERNAL_DATA", t.TempDir())
+
+	old := local.Database("test.db")
+	t.Cleanup(func() { old.Close() })
+	if err := old.Register(new(countText)); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := database.Manage(old, new(countText))
+	for _, count := range counts {
+		if _, err := rows.Insert(&countText{Model: old.NewModel(""), Count: count}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := local.Database("test.db", database.WithRebuilds())
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRebuildConvertsColumnType(t *testing.T) {
+	db := open(t, "12", "7")
+
+	if err := db.Register(new(countInt)); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	var type_ string
+	if err := db.Query(`SELECT type FROM pragma_table_info('counts') WHERE name = 'Count'`).Scan(&type_); err != nil {
+		t.Fatal(err)
+	}
+	if type_ != "INTEGER" {
+		t.Errorf("Count is %s, want INTEGER", type_)
+	}
+
+	counts, err := database.Manage(db, new(countInt)).OrderBy("Count", database.Asc).All()
+	if err != nil {
+		t.Fatalf("reading rebuilt rows: %v", err)
+	}
+	if len(counts) != 2 || counts[0].Count != 7 || counts[1].Count != 12 {
+		t.Errorf("got %d rows, want counts 7 and 12", len(counts))
+	}
+}
+
+func TestRebuildRefusesValuesThatDoNotConvert(t *testing.T) {
+	db := open(t, "12", "p1")
+
+	if err := db.Register(new(countInt)); err == nil {
+		t.Fatal("Register changed Count to INTEGER with a row holding p1")
+	}
+
+	var type_ string
+	if err := db.Query(`SELECT type FROM pragma_table_info('counts') WHERE name = 'Count'`).Scan(&type_); err != nil {
+		t.Fatal(err)
+	}
+	if type_ != "TEXT" {
+		t.Errorf("Count is %s, want the table left as TEXT", type_)
+	}
+
+	var rows int
+	if err := db.Query(`SELECT count(*) FROM counts WHERE Count IN ('12', 'p1')`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 2 {
+		t.Errorf("%d rows kept their counts, want 2", rows)
+	}
+}
+
+func TestSkippedChangesAreReportedOnce(t *testing.T) {
+	t.Setenv("INTERNAL_DATA", t.TempDir())
+
+	old := local.Database("test.db")
+	if err := old.Register(new(countText)); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for start := range 2 {
+		logs.Reset()
+		db := local.Database("test.db")
+		if err := db.Register(new(countInt)); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+
+		if skipped := strings.Contains(logs.String(), "Skipped"); skipped != (start == 0) {
+			t.Errorf("start %d logged %q", start+1, logs.String())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// txEngine runs the queries of a transaction, on its own
+// connection, for the engine it began on
+type txEngine struct {
+	Database
+	tx     *sql.Tx
+	depth  int
+	models *txModels
+}
+
+// txModels are the models bound to a transaction, pointed back at
+// the database it began on once the transaction ends
+type txModels struct {
+	mu     sync.Mutex
+	models []*Model
+}
+
+func (e *txEngine) Query(query string, args ...any) *Iter {
+	return &Iter{Conn: e.tx, Text: query, Args: args}
+}
+
+// Tx runs fn in a transaction, committed when fn returns nil and rolled
+// back when it returns an error or panics. The database passed to fn runs
+// on the transaction, as do its collections and those bound to it with
+// In. Calling Tx on it again runs fn in a savepoint. Entities loaded or
+// inserted in fn are bound back to db when the transaction ends.
+//
+//	err := db.Tx(ctx, func(tx *database.DynamicDB) error {
+//		if _, err := Users.In(tx).Insert(user); err != nil {
+//			return err
+//		}
+//		_, err := Sessions.In(tx).Insert(&Session{UserID: user.ID})
+//		return err
+//	})
+func (db *DynamicDB) Tx(ctx context.Context, fn func(tx *DynamicDB) error) (err error) {
+	if e, ok := db.Database.(*txEngine); ok {
+		return db.savepoint(e, fn)
+	}
+
+	beginner, ok := db.Database.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+	})
+	if !ok {
+		return errors.New("database does not support transactions")
+	}
+
+	tx, err := beginner.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	models := &txModels{}
+	defer func() {
+		defer models.release(db)
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = errors.Wrap(tx.Commit(), "failed to commit transaction")
+	}()
+
+	return fn(db.scoped(&txEngine{db.Database, tx, 0, models}))
+}
+
+// savepoint runs fn in a savepoint of the transaction, undoing
+// only its changes when it fails
+func (db *DynamicDB) savepoint(e *txEngine, fn func(tx *DynamicDB) error) (err error) {
+	name := fmt.Sprintf("savepoint_%d", e.depth+1)
+	if _, err := e.tx.Exec("SAVEPOINT " + name); err != nil {
+		return errors.Wrap(err, "failed to create savepoint")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			e.tx.Exec("ROLLBACK TO " + name)
+			e.tx.Exec("RELEASE " + name)
+			panic(p)
+		}
+		if err != nil {
+			e.tx.Exec("ROLLBACK TO " + name)
+			e.tx.Exec("RELEASE " + name)
+			return
+		}
+		_, err = e.tx.Exec("RELEASE " + name)
+		err = errors.Wrap(err, "failed to release savepoint")
+	}()
+
+	return fn(db.scoped(&txEngine{e.Database, e.tx, e.depth + 1, e.models}))
+}
+
+// bind points the entity's model at the database, keeping track of
+// it when the database runs on a transaction
+func (db *DynamicDB) bind(ent Entity) {
+	model := ent.GetModel()
+	model.SetDB(db)
+	if e, ok := db.Database.(*txEngine); ok {
+		e.models.mu.Lock()
+		e.models.models = append(e.models.models, model)
+		e.models.mu.Unlock()
+	}
+}
+
+// release binds the models still on the finished transaction to db
+func (m *txModels) release(db *DynamicDB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, model := range m.models {
+		if scoped, ok := model.DB.(*DynamicDB); ok {
+			if _, ok := scoped.Database.(*txEngine); ok {
+				model.DB = db
+			}
+		}
+	}
+	m.models = nil
+}
+
+// scoped copies the database to run on the engine, with its
+// collections bound to the copy
+func (db *DynamicDB) scoped(engine Database) *DynamicDB {
+	scoped := *db
+	scoped.Database = engine
+	scoped.Repos = map[string]*Collection[Entity]{}
+	for table, c := range db.Repos {
+		scoped.Repos[table] = c.In(&scoped)
+	}
+	return &scoped
+}
@@ -0,0 +1,65 @@
+package database_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/database"
+	"github.com/The-Skyscape/devtools/pkg/database/local"
+)
+
+func TestTxBindsEntitiesBack(t *testing.T) {
+	t.Setenv("INTERNAL_DATA", t.TempDir())
+
+	db := local.Database("test.db")
+	t.Cleanup(func() { db.Close() })
+	counts := database.Manage(db, new(countInt))
+
+	var count *countInt
+	err := db.Tx(context.Background(), func(tx *database.DynamicDB) (err error) {
+		count, err = counts.In(tx).Insert(&countInt{Count: 1})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.DB != db {
+		t.Errorf("entity inserted in a transaction is still bound to it")
+	}
+}
+
+func TestTxReadThenWriteConcurrently(t *testing.T) {
+	t.Setenv("INTERNAL_DATA", t.TempDir())
+
+	db := local.Database("test.db")
+	t.Cleanup(func() { db.Close() })
+	counts := database.Manage(db, new(countInt))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.Tx(context.Background(), func(tx *database.DynamicDB) error {
+				n := counts.In(tx).Count()
+				time.Sleep(time.Millisecond)
+				_, err := counts.In(tx).Insert(&countInt{Count: n})
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := counts.Count(); n != 8 {
+		t.Errorf("counted %d rows after 8 transactions", n)
+	}
+}